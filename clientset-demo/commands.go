@@ -0,0 +1,638 @@
+package main
+
+import (
+	"clientset-demo/controller"
+	"clientset-demo/util"
+	"context"
+	"flag"
+	"fmt"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCommand runs the sub command given after the global flags, e.g.
+//
+//	clientset-demo -namespace nginx apply -f cluster/yaml/test/nginx.yaml
+func runCommand(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	switch args[0] {
+	case "apply":
+		return runApply(ctx, configController, clientset, args[1:])
+	case "rollout":
+		return runRollout(ctx, configController, clientset, args[1:])
+	case "namespace":
+		return runNamespace(ctx, clientset, args[1:])
+	case "reconcile":
+		return runReconcile(ctx, clientset, args[1:])
+	case "job":
+		return runJob(ctx, configController, clientset, args[1:])
+	case "cronjob":
+		return runCronJob(ctx, configController, clientset, args[1:])
+	case "configmap":
+		return runConfigMap(ctx, configController, clientset, args[1:])
+	case "secret":
+		return runSecret(ctx, configController, clientset, args[1:])
+	case "stamp":
+		return runStamp(ctx, configController, clientset, args[1:])
+	case "pod":
+		return runPod(ctx, configController, clientset, args[1:])
+	case "scale":
+		return runScale(ctx, configController, clientset, args[1:])
+	case "hpa":
+		return runAutoscaler(ctx, configController, clientset, args[1:])
+	}
+
+	return fmt.Errorf("unknown command %q, supported: apply, rollout, namespace, reconcile, job, cronjob, configmap, secret, stamp, pod, scale, hpa", args[0])
+}
+
+func runApply(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	var files []string
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	flags.Func("f", "manifest file to apply, can be repeated", func(value string) error {
+		files = append(files, value)
+		return nil
+	})
+	fieldManager := flags.String("field-manager", "clientset-demo", "(optional) field manager name used for server-side apply")
+	configHash := flags.Bool("config-hash", true, "(optional) stamp the hash of their configmaps and secrets on deployments, rolling them when those change")
+	forceConflicts := flags.Bool("force-conflicts", false, "(optional) take over the fields owned by other field managers instead of failing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	files = append(files, flags.Args()...)
+	if len(files) == 0 {
+		return fmt.Errorf("apply: no manifest given, use -f FILE")
+	}
+
+	f, err := configController.GetFactory()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := f.DynamicClient()
+	if err != nil {
+		return err
+	}
+	mapper, err := f.RESTMapper()
+	if err != nil {
+		return err
+	}
+	applyController := controller.NewApplyController(clientset, dynamicClient, mapper, *fieldManager).
+		WithConfigHash(*configHash).
+		WithForceConflicts(*forceConflicts)
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	for _, file := range files {
+		opCtx, cancel := withTimeout(ctx)
+		applied, err := applyController.ApplyFile(opCtx, file, namespace)
+		cancel()
+		for _, object := range applied {
+			fmt.Println(object)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runRollout handles "rollout status|history NAME" and "rollout undo NAME [-to-revision N]".
+func runRollout(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: rollout status|history|undo NAME")
+	}
+	deploymentController := controller.NewDeploymentController(clientset, controller.WithPageSize(configController.PageSize()))
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	name := args[1]
+	switch args[0] {
+	case "status":
+		return deploymentController.WaitForRollout(ctx, namespace, name)
+	case "history":
+		opCtx, cancel := withTimeout(ctx)
+		defer cancel()
+		history, err := deploymentController.RolloutHistory(opCtx, namespace, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("REVISION\tREPLICASET\tCHANGE-CAUSE\n")
+		for _, revision := range history {
+			fmt.Printf("%d\t\t%s\t%s\n", revision.Revision, revision.ReplicaSet, revision.ChangeCause)
+			if revision.Diff != "" {
+				fmt.Printf("\t\ttemplate diff: %s\n", revision.Diff)
+			}
+		}
+		return nil
+	case "undo":
+		flags := flag.NewFlagSet("rollout undo", flag.ContinueOnError)
+		toRevision := flags.Int64("to-revision", 0, "(optional) revision to roll back to, 0 means the previous one")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		opCtx, cancel := withTimeout(ctx)
+		defer cancel()
+		_, err := deploymentController.RolloutUndo(opCtx, namespace, name, *toRevision)
+		return err
+	}
+
+	return fmt.Errorf("unknown rollout command %q, supported: status, history, undo", args[0])
+}
+
+// runNamespace handles "namespace bootstrap|reconcile NAME", using the default profile, and "namespace delete NAME [-wait-timeout DURATION]".
+func runNamespace(ctx context.Context, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 || (args[0] != "delete" && len(args) != 2) {
+		return fmt.Errorf("usage: namespace bootstrap|reconcile NAME, namespace delete NAME [-wait-timeout DURATION]")
+	}
+	namespaceController := controller.NewNamespaceController(clientset)
+	name := args[1]
+	opCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	switch args[0] {
+	case "bootstrap":
+		return namespaceController.BootstrapNamespace(opCtx, name, controller.DefaultNamespaceProfile())
+	case "reconcile":
+		return namespaceController.ReconcileNamespaceProfile(opCtx, name, controller.DefaultNamespaceProfile())
+	case "delete":
+		flags := flag.NewFlagSet("namespace delete", flag.ContinueOnError)
+		waitTimeout := flags.Duration("wait-timeout", 5*time.Minute, "(optional) how long to wait for the finalizers, 0 waits until interrupted")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		// Finalizers can take a while, wait without the per-operation timeout.
+		waitCtx := ctx
+		if *waitTimeout > 0 {
+			var cancelWait context.CancelFunc
+			waitCtx, cancelWait = context.WithTimeout(ctx, *waitTimeout)
+			defer cancelWait()
+		}
+		return namespaceController.DeleteNamespaceAndWait(waitCtx, name)
+	}
+
+	return fmt.Errorf("unknown namespace command %q, supported: bootstrap, reconcile, delete", args[0])
+}
+
+// runJob handles "job wait|delete NAME".
+func runJob(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: job wait|delete NAME")
+	}
+	jobController := controller.NewJobController(clientset)
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	name := args[1]
+	switch args[0] {
+	case "wait":
+		// The job's activeDeadlineSeconds bounds the wait, not -timeout.
+		_, err := jobController.WaitForJob(ctx, namespace, name)
+		return err
+	case "delete":
+		opCtx, cancel := withTimeout(ctx)
+		defer cancel()
+		return jobController.DeleteJob(opCtx, namespace, name)
+	}
+
+	return fmt.Errorf("unknown job command %q, supported: wait, delete", args[0])
+}
+
+// runCronJob handles "cronjob trigger NAME [-wait]" and "cronjob suspend|resume NAME".
+func runCronJob(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: cronjob trigger|suspend|resume NAME")
+	}
+	cronJobController := controller.NewCronJobController(clientset)
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	name := args[1]
+	opCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	switch args[0] {
+	case "trigger":
+		flags := flag.NewFlagSet("cronjob trigger", flag.ContinueOnError)
+		wait := flags.Bool("wait", false, "(optional) wait for the job to complete")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		job, err := cronJobController.TriggerCronJob(opCtx, namespace, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("job.batch/%s created\n", job.Name)
+		if *wait {
+			_, err = controller.NewJobController(clientset).WaitForJob(ctx, namespace, job.Name)
+		}
+		return err
+	case "suspend", "resume":
+		_, err := cronJobController.SuspendCronJob(opCtx, namespace, name, args[0] == "suspend")
+		return err
+	}
+
+	return fmt.Errorf("unknown cronjob command %q, supported: trigger, suspend, resume", args[0])
+}
+
+// fileSources collects the repeatable -from-file flag, see controller.NewConfigMapFromFiles.
+func fileSources(flags *flag.FlagSet) *[]string {
+	var sources []string
+	flags.Func("from-file", "file, key=file or directory to read, can be repeated", func(value string) error {
+		sources = append(sources, value)
+		return nil
+	})
+	return &sources
+}
+
+// runConfigMap handles "configmap create NAME -from-file SOURCE...", an existing configmap gets the new data.
+func runConfigMap(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 || args[0] != "create" {
+		return fmt.Errorf("usage: configmap create NAME -from-file SOURCE")
+	}
+	flags := flag.NewFlagSet("configmap create", flag.ContinueOnError)
+	sources := fileSources(flags)
+	if err := flags.Parse(args[2:]); err != nil {
+		return err
+	}
+	configMap, err := controller.NewConfigMapFromFiles(configController.Namespace(metav1.NamespaceDefault), args[1], *sources...)
+	if err != nil {
+		return err
+	}
+	opCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = controller.NewConfigMapController(clientset).EnsureConfigMap(opCtx, configMap)
+	return err
+}
+
+// runSecret handles "secret generic|tls|docker-registry NAME FLAGS", an existing secret gets the new data.
+func runSecret(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: secret generic|tls|docker-registry NAME")
+	}
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	name := args[1]
+	flags := flag.NewFlagSet("secret "+args[0], flag.ContinueOnError)
+	var build func() (*apiv1.Secret, error)
+	switch args[0] {
+	case "generic":
+		sources := fileSources(flags)
+		build = func() (*apiv1.Secret, error) {
+			return controller.NewOpaqueSecretFromFiles(namespace, name, *sources...)
+		}
+	case "tls":
+		cert := flags.String("cert", "", "PEM encoded certificate file")
+		key := flags.String("key", "", "PEM encoded private key file")
+		build = func() (*apiv1.Secret, error) {
+			return controller.NewTLSSecret(namespace, name, *cert, *key)
+		}
+	case "docker-registry":
+		server := flags.String("docker-server", "", "registry to pull from, e.g. harbor.dev.com")
+		username := flags.String("docker-username", "", "registry username")
+		password := flags.String("docker-password", "", "registry password")
+		email := flags.String("docker-email", "", "(optional) registry email")
+		build = func() (*apiv1.Secret, error) {
+			return controller.NewDockerConfigSecret(namespace, name, *server, *username, *password, *email)
+		}
+	default:
+		return fmt.Errorf("unknown secret type %q, supported: generic, tls, docker-registry", args[0])
+	}
+	if err := flags.Parse(args[2:]); err != nil {
+		return err
+	}
+	secret, err := build()
+	if err != nil {
+		return err
+	}
+	opCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err = controller.NewSecretController(clientset).EnsureSecret(opCtx, secret)
+	return err
+}
+
+// runStamp handles "stamp DEPLOYMENT -configmap NAME -secret NAME", rolling the deployment when their content changed.
+func runStamp(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: stamp DEPLOYMENT -configmap NAME -secret NAME")
+	}
+	var configMaps, secrets []string
+	flags := flag.NewFlagSet("stamp", flag.ContinueOnError)
+	flags.Func("configmap", "configmap used by the deployment, can be repeated", func(value string) error {
+		configMaps = append(configMaps, value)
+		return nil
+	})
+	flags.Func("secret", "secret used by the deployment, can be repeated", func(value string) error {
+		secrets = append(secrets, value)
+		return nil
+	})
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	opCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := controller.NewDeploymentController(clientset).StampConfigHash(opCtx, configController.Namespace(metav1.NamespaceDefault), args[0], configMaps, secrets)
+	return err
+}
+
+// runPod handles "pod logs|exec|port-forward|evict NAME FLAGS", e.g.
+//
+//	clientset-demo -namespace nginx pod logs nginx-demo-0 -f -tail 100
+//	clientset-demo -namespace nginx pod exec nginx-demo-0 -i -t -- sh
+//	clientset-demo -namespace nginx pod port-forward nginx-demo-0 8080:80
+func runPod(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: pod logs|exec|port-forward|evict NAME")
+	}
+	restConfig, err := configController.GetRESTConfig()
+	if err != nil {
+		return err
+	}
+	podController := controller.NewPodController(clientset, restConfig)
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	name := args[1]
+	flags := flag.NewFlagSet("pod "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "logs":
+		container := flags.String("c", "", "(optional) container, defaults to the only or the default container")
+		follow := flags.Bool("f", false, "(optional) stream new logs until the container exits or interrupted")
+		previous := flags.Bool("previous", false, "(optional) logs of the previous, terminated instance of the container")
+		since := flags.Duration("since", 0, "(optional) only logs newer than this, e.g. 10m")
+		tail := flags.Int64("tail", -1, "(optional) number of recent lines to show, -1 shows all")
+		timestamps := flags.Bool("timestamps", false, "(optional) prefix every line with its timestamp")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		options := apiv1.PodLogOptions{Container: *container, Follow: *follow, Previous: *previous, Timestamps: *timestamps}
+		if *since > 0 {
+			seconds := int64(since.Seconds())
+			options.SinceSeconds = &seconds
+		}
+		if *tail >= 0 {
+			options.TailLines = tail
+		}
+		// Following ends with the container or an interrupt, not -timeout.
+		return podController.StreamLogs(ctx, namespace, name, options, os.Stdout)
+	case "exec":
+		container := flags.String("c", "", "(optional) container, defaults to the only or the default container")
+		stdin := flags.Bool("i", false, "(optional) pass stdin to the command")
+		tty := flags.Bool("t", false, "(optional) allocate a terminal, stderr then goes to stdout")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 {
+			return fmt.Errorf("usage: pod exec NAME [-c CONTAINER] [-i] [-t] -- COMMAND [ARG...]")
+		}
+		options := controller.ExecOptions{Container: *container, Command: flags.Args(), Stdout: os.Stdout, Stderr: os.Stderr, TTY: *tty}
+		if *stdin {
+			options.Stdin = os.Stdin
+		}
+		terminal := util.Terminal{In: os.Stdin, Out: os.Stdout}
+		if !options.TTY {
+			return podController.Exec(ctx, namespace, name, options)
+		}
+		if !terminal.IsTerminal() {
+			log.Println("Unable to use a TTY - input is not a terminal")
+			options.TTY = false
+			return podController.Exec(ctx, namespace, name, options)
+		}
+		// Like kubectl, the local terminal goes raw and the remote one follows its size.
+		sizeCtx, stopMonitoring := context.WithCancel(ctx)
+		defer stopMonitoring()
+		options.TerminalSizeQueue = terminal.MonitorSize(sizeCtx)
+		return terminal.Safe(func() error {
+			return podController.Exec(ctx, namespace, name, options)
+		})
+	case "port-forward":
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 {
+			return fmt.Errorf("usage: pod port-forward NAME [LOCAL:]REMOTE...")
+		}
+		// Forwards until interrupted.
+		return podController.PortForward(ctx, namespace, name, flags.Args(), nil, os.Stdout)
+	case "evict":
+		gracePeriod := flags.Int64("grace-period", -1, "(optional) seconds given to the pod to terminate, -1 keeps the one of the pod")
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+		var gracePeriodSeconds *int64
+		if *gracePeriod >= 0 {
+			gracePeriodSeconds = gracePeriod
+		}
+		// A blocking PodDisruptionBudget is retried until -timeout.
+		opCtx, cancel := withTimeout(ctx)
+		defer cancel()
+		return podController.EvictPod(opCtx, namespace, name, gracePeriodSeconds)
+	}
+
+	return fmt.Errorf("unknown pod command %q, supported: logs, exec, port-forward, evict", args[0])
+}
+
+// runScale handles "scale RESOURCE NAME -replicas N [-current-replicas N] [-resource-version RV] [-wait]", e.g.
+//
+//	clientset-demo -namespace nginx scale deployments nginx-demo -replicas 3 -current-replicas 2 -wait
+func runScale(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: scale RESOURCE NAME -replicas N")
+	}
+	flags := flag.NewFlagSet("scale", flag.ContinueOnError)
+	replicas := flags.Int("replicas", -1, "new number of replicas")
+	currentReplicas := flags.Int("current-replicas", -1, "(optional) only scale when the resource currently has that many replicas")
+	resourceVersion := flags.String("resource-version", "", "(optional) only scale when the scale is still at that resource version")
+	wait := flags.Bool("wait", false, "(optional) wait for the replicas to be ready")
+	if err := flags.Parse(args[2:]); err != nil {
+		return err
+	}
+	if *replicas < 0 {
+		return fmt.Errorf("scale: -replicas is required")
+	}
+	options := &controller.ScaleOptions{Replicas: int32(*replicas), ResourceVersion: *resourceVersion}
+	if *currentReplicas >= 0 {
+		current := int32(*currentReplicas)
+		options.CurrentReplicas = &current
+	}
+
+	f, err := configController.GetFactory()
+	if err != nil {
+		return err
+	}
+	mapper, err := f.RESTMapper()
+	if err != nil {
+		return err
+	}
+	scales, err := f.ScaleClient()
+	if err != nil {
+		return err
+	}
+	scaleController := controller.NewScaleController(clientset, scales, mapper, controller.WithPageSize(configController.PageSize()))
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	resource, name := args[0], args[1]
+	opCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	if _, err := scaleController.Scale(opCtx, resource, namespace, name, options); err != nil {
+		return err
+	}
+	fmt.Printf("%s/%s scaled\n", resource, name)
+	if *wait {
+		// Pods may take longer than -timeout to start, wait until interrupted.
+		return scaleController.WaitForReplicas(ctx, resource, namespace, name, options.Replicas)
+	}
+	return nil
+}
+
+// runAutoscaler handles "hpa set|status|delete DEPLOYMENT", e.g.
+//
+//	clientset-demo -namespace nginx hpa set nginx-demo -max 10 -cpu 70 -pods-metric http_requests_per_second=100
+func runAutoscaler(ctx context.Context, configController *controller.ConfigController, clientset kubernetes.Interface, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: hpa set|status|delete DEPLOYMENT")
+	}
+	autoscalerController := controller.NewAutoscalerController(clientset)
+	namespace := configController.Namespace(metav1.NamespaceDefault)
+	name := args[1]
+	opCtx, cancel := withTimeout(ctx)
+	defer cancel()
+	switch args[0] {
+	case "set":
+		options, err := autoscalerOptions(args[2:])
+		if err != nil {
+			return err
+		}
+		_, err = autoscalerController.EnsureAutoscaler(opCtx, namespace, name, options)
+		return err
+	case "status":
+		status, err := autoscalerController.AutoscalerStatus(opCtx, namespace, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Name:\t\t%s\nTarget:\t\t%s\nReplicas:\t%d current / %d desired (min %d, max %d)\n",
+			status.Name, status.Target, status.CurrentReplicas, status.DesiredReplicas, status.MinReplicas, status.MaxReplicas)
+		if status.LastScaleTime != nil {
+			fmt.Printf("Last scale:\t%s\n", status.LastScaleTime.Format(time.RFC3339))
+		}
+		fmt.Printf("METRIC\tCURRENT\tTARGET\n")
+		for _, metric := range status.Metrics {
+			fmt.Printf("%s\t%s\t%s\n", metric.Name, metric.Current, metric.Target)
+		}
+		fmt.Printf("CONDITION\tSTATUS\tREASON\tMESSAGE\n")
+		for _, condition := range status.Conditions {
+			fmt.Printf("%s\t%s\t%s\t%s\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+		}
+		return nil
+	case "delete":
+		return autoscalerController.DeleteAutoscaler(opCtx, namespace, name)
+	}
+
+	return fmt.Errorf("unknown hpa command %q, supported: set, status, delete", args[0])
+}
+
+// autoscalerOptions parses the flags of "hpa set".
+func autoscalerOptions(args []string) (*controller.AutoscalerOptions, error) {
+	options := &controller.AutoscalerOptions{}
+	flags := flag.NewFlagSet("hpa set", flag.ContinueOnError)
+	minReplicas := flags.Int("min", 1, "(optional) minimum number of replicas")
+	flags.Func("max", "maximum number of replicas", func(value string) error {
+		maxReplicas, err := strconv.ParseInt(value, 10, 32)
+		options.MaxReplicas = int32(maxReplicas)
+		return err
+	})
+	cpu := flags.Int("cpu", 0, "(optional) target average CPU utilization in percent of the requests")
+	memory := flags.Int("memory", 0, "(optional) target average memory utilization in percent of the requests")
+	flags.Func("pods-metric", "(optional) NAME=AVERAGE target of a custom metric of the pods, can be repeated", func(value string) error {
+		name, target, err := metricTarget(value)
+		if err != nil {
+			return err
+		}
+		options.Metrics = append(options.Metrics, controller.PodsMetric(name, target))
+		return nil
+	})
+	flags.Func("external-metric", "(optional) NAME=AVERAGE target of an external metric, can be repeated", func(value string) error {
+		name, target, err := metricTarget(value)
+		if err != nil {
+			return err
+		}
+		options.Metrics = append(options.Metrics, controller.ExternalMetric(name, nil, target))
+		return nil
+	})
+	scaleDownWindow := flags.Int("scale-down-window", -1, "(optional) seconds of recommendations considered before scaling down, default 300")
+	scaleDownPercent := flags.Int("scale-down-percent", 0, "(optional) maximum percent of the replicas removed per minute")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	minimum := int32(*minReplicas)
+	options.MinReplicas = &minimum
+	if *cpu > 0 {
+		options.Metrics = append(options.Metrics, controller.ResourceUtilizationMetric(apiv1.ResourceCPU, int32(*cpu)))
+	}
+	if *memory > 0 {
+		options.Metrics = append(options.Metrics, controller.ResourceUtilizationMetric(apiv1.ResourceMemory, int32(*memory)))
+	}
+	if *scaleDownWindow >= 0 || *scaleDownPercent > 0 {
+		window := int32(300)
+		if *scaleDownWindow >= 0 {
+			window = int32(*scaleDownWindow)
+		}
+		var policies []autoscalingv2.HPAScalingPolicy
+		if *scaleDownPercent > 0 {
+			policies = append(policies, controller.PercentPolicy(int32(*scaleDownPercent), 60))
+		}
+		options.Behavior = &autoscalingv2.HorizontalPodAutoscalerBehavior{ScaleDown: controller.ScalingRules(window, policies...)}
+	}
+
+	return options, nil
+}
+
+// metricTarget parses a NAME=QUANTITY metric flag.
+func metricTarget(value string) (string, resource.Quantity, error) {
+	name, quantity, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return "", resource.Quantity{}, fmt.Errorf("expected NAME=QUANTITY, got %q", value)
+	}
+	target, err := resource.ParseQuantity(quantity)
+	return name, target, err
+}
+
+// runReconcile runs the service reconciler until interrupted, see controller.ServiceReconciler.
+func runReconcile(ctx context.Context, clientset kubernetes.Interface, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	workers := flags.Int("workers", 2, "(optional) number of deployments reconciled concurrently")
+	leaderElect := flags.Bool("leader-elect", false, "(optional) reconcile only while holding the lease, for running several replicas")
+	election := controller.DefaultLeaderElectionOptions("clientset-demo-reconciler")
+	flags.StringVar(&election.LeaseName, "lease-name", election.LeaseName, "(optional) name of the leader election lease")
+	flags.StringVar(&election.LeaseNamespace, "lease-namespace", election.LeaseNamespace, "(optional) namespace of the leader election lease")
+	flags.StringVar(&election.Identity, "lease-identity", "", "(optional) identity of this replica, defaults to the hostname and a random suffix")
+	flags.DurationVar(&election.LeaseDuration, "lease-duration", election.LeaseDuration, "(optional) how long a lease that is not renewed blocks the other replicas")
+	flags.DurationVar(&election.RenewDeadline, "renew-deadline", election.RenewDeadline, "(optional) how long the leader retries renewing before it stops leading")
+	flags.DurationVar(&election.RetryPeriod, "retry-period", election.RetryPeriod, "(optional) interval between two acquire or renew attempts")
+	flags.BoolVar(&election.ReleaseOnCancel, "release-on-cancel", election.ReleaseOnCancel, "(optional) release the lease on shutdown so another replica takes over at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *leaderElect {
+		// Informers and queue are created per term, a new leader starts from a fresh cache.
+		return controller.RunWithLeaderElection(ctx, clientset, election, leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				if err := reconcile(ctx, clientset, *workers); err != nil {
+					log.Println(err)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				log.Printf("current leader: %s\n", identity)
+			},
+		})
+	}
+
+	return reconcile(ctx, clientset, *workers)
+}
+
+func reconcile(ctx context.Context, clientset kubernetes.Interface, workers int) error {
+	cache, err := controller.NewCache(clientset, *resync)
+	if err != nil {
+		return err
+	}
+	reconciler, err := controller.NewServiceReconciler(clientset, cache, controller.WithRequestTimeout(*timeout))
+	if err != nil {
+		return err
+	}
+	cache.Start(ctx)
+	return reconciler.Run(ctx, workers)
+}
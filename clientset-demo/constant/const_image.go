@@ -0,0 +1,6 @@
+package constant
+
+const (
+	NginxImage     = "harbor.dev.com/test-demo/nginx:1.12"
+	NginxNextImage = "harbor.dev.com/test-demo/nginx:1.13"
+)
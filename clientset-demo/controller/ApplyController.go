@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"bytes"
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"log"
+	"os"
+	"strings"
+)
+
+// ApplyResult tells what applying an object did, with the same wording as kubectl apply.
+type ApplyResult string
+
+const (
+	ApplyCreated    ApplyResult = "created"
+	ApplyConfigured ApplyResult = "configured"
+	ApplyUnchanged  ApplyResult = "unchanged"
+)
+
+// AppliedObject is the outcome of applying one manifest document.
+type AppliedObject struct {
+	Resource  string // e.g. "deployment.apps".
+	Namespace string
+	Name      string
+	Result    ApplyResult
+}
+
+func (o AppliedObject) String() string {
+	return fmt.Sprintf("%s/%s %s", o.Resource, o.Name, o.Result)
+}
+
+// ApplyController creates or updates the objects of YAML/JSON manifests, of any kind the API server serves.
+// Kinds are mapped to their resource with the RESTMapper and sent through the dynamic client as written in the manifest.
+type ApplyController struct {
+	clientset      kubernetes.Interface
+	dynamicClient  dynamic.Interface
+	mapper         meta.RESTMapper
+	fieldManager   string
+	configHash     bool // stamp the ConfigHash of their configmaps and secrets on deployments, see WithConfigHash.
+	forceConflicts bool // take over the fields other managers own, see WithForceConflicts.
+}
+
+func NewApplyController(clientset kubernetes.Interface, dynamicClient dynamic.Interface, mapper meta.RESTMapper, fieldManager string) *ApplyController {
+	return &ApplyController{clientset: clientset, dynamicClient: dynamicClient, mapper: mapper, fieldManager: fieldManager}
+}
+
+// WithConfigHash stamps ConfigHashAnnotation on the pod template of the applied deployments, computed from the
+// configmaps and secrets the pods mount or read environment variables from. Applying the same manifest again
+// then rolls the pods once one of them changed. Sources that don't exist yet are left out of the hash.
+func (receiver *ApplyController) WithConfigHash(enabled bool) *ApplyController {
+	receiver.configHash = enabled
+	return receiver
+}
+
+// WithForceConflicts makes server-side apply take over the fields another field manager owns, like
+// "kubectl apply --server-side --force-conflicts". Without it such a change fails with errs.Conflict.
+func (receiver *ApplyController) WithForceConflicts(force bool) *ApplyController {
+	receiver.forceConflicts = force
+	return receiver
+}
+
+// DecodeManifests decodes every document of a multi-document YAML or JSON stream, keeping the fields as written.
+// Documents of a kind the client-go scheme knows are checked against its Go type.
+func DecodeManifests(reader io.Reader) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for i := 0; ; i++ {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || bytes.Equal(raw.Raw, []byte("null")) {
+			continue // empty document, e.g. a trailing "---".
+		}
+
+		object := &unstructured.Unstructured{}
+		if err := object.UnmarshalJSON(raw.Raw); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if typed, err := scheme.Scheme.New(object.GroupVersionKind()); err == nil {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typed); err != nil {
+				return nil, fmt.Errorf("document %d: %w", i, err)
+			}
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+// ApplyFile applies every object of the manifest at path in order.
+// Objects without a namespace go to namespace.
+func (receiver *ApplyController) ApplyFile(ctx context.Context, path, namespace string) ([]AppliedObject, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	objects, err := DecodeManifests(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	var applied []AppliedObject
+	for _, object := range objects {
+		result, err := receiver.Apply(ctx, object, namespace)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, result)
+	}
+
+	return applied, nil
+}
+
+// Apply creates or updates object with server-side apply, falling back to get + create/update
+// when the API server does not support it. Namespaced objects without a namespace go to namespace.
+func (receiver *ApplyController) Apply(ctx context.Context, object *unstructured.Unstructured, namespace string) (AppliedObject, error) {
+	gvk := object.GroupVersionKind()
+	applied := AppliedObject{Resource: strings.ToLower(gvk.GroupKind().String()), Name: object.GetName()}
+	mapping, err := receiver.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return applied, &errs.Error{Kind: errs.NotFound, Op: "apply " + applied.Resource, Err: err}
+	}
+	if err != nil {
+		return applied, errs.Wrapf(err, "map %s to its resource", applied.Resource)
+	}
+	var client dynamic.ResourceInterface = receiver.dynamicClient.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if object.GetNamespace() == "" {
+			object.SetNamespace(namespace)
+		}
+		client = receiver.dynamicClient.Resource(mapping.Resource).Namespace(object.GetNamespace())
+	}
+	applied.Namespace = object.GetNamespace()
+	log.Printf("Applying %s: namespace: %s, name: %s\n", applied.Resource, applied.Namespace, applied.Name)
+
+	existing, err := client.Get(ctx, applied.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return applied, errs.Wrapf(err, "get %s %s", applied.Resource, applied.Name)
+	}
+	if apierrors.IsNotFound(err) {
+		existing = nil
+	}
+
+	if receiver.configHash && gvk.GroupKind() == appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind() {
+		if err := receiver.stampDeploymentConfigHash(ctx, object); err != nil {
+			return applied, err
+		}
+	}
+	data, err := object.MarshalJSON()
+	if err != nil {
+		return applied, err
+	}
+	stored, err := client.Patch(ctx, applied.Name, types.ApplyPatchType, data, receiver.applyOptions())
+	if isApplyUnsupported(err) {
+		log.Printf("server-side apply is not supported, falling back to create/update\n")
+		stored, err = receiver.createOrUpdate(ctx, client, mapping.Resource, object, existing)
+	}
+	if err != nil {
+		return applied, errs.Wrapf(err, "apply %s %s", applied.Resource, applied.Name)
+	}
+
+	switch {
+	case existing == nil:
+		applied.Result = ApplyCreated
+	case existing.GetResourceVersion() == stored.GetResourceVersion():
+		applied.Result = ApplyUnchanged
+	default:
+		applied.Result = ApplyConfigured
+	}
+
+	return applied, nil
+}
+
+func (receiver *ApplyController) applyOptions() metav1.PatchOptions {
+	force := receiver.forceConflicts
+	return metav1.PatchOptions{FieldManager: receiver.fieldManager, Force: &force}
+}
+
+// stampDeploymentConfigHash stamps the ConfigHash of the configmaps and secrets the pods of deployment use.
+func (receiver *ApplyController) stampDeploymentConfigHash(ctx context.Context, deployment *unstructured.Unstructured) error {
+	var typed appsv1.Deployment
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(deployment.Object, &typed); err != nil {
+		return err
+	}
+	configMapNames, secretNames := podConfigSources(&typed.Spec.Template.Spec)
+	if len(configMapNames) == 0 && len(secretNames) == 0 {
+		return nil
+	}
+	configHash, err := fetchConfigHash(ctx, receiver.clientset, deployment.GetNamespace(), configMapNames, secretNames, true)
+	if err != nil {
+		return err
+	}
+
+	return unstructured.SetNestedField(deployment.Object, configHash, "spec", "template", "metadata", "annotations", ConfigHashAnnotation)
+}
+
+func (receiver *ApplyController) createOrUpdate(ctx context.Context, client dynamic.ResourceInterface, resource schema.GroupVersionResource,
+	object, existing *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if existing == nil {
+		return client.Create(ctx, object, metav1.CreateOptions{FieldManager: receiver.fieldManager})
+	}
+	object = object.DeepCopy()
+	object.SetResourceVersion(existing.GetResourceVersion())
+	if resource.GroupResource() == apiv1.Resource("services") {
+		// spec.clusterIP(s) are immutable, keep the allocated ones when the manifest leaves them empty.
+		if clusterIP, _, _ := unstructured.NestedString(object.Object, "spec", "clusterIP"); clusterIP == "" {
+			for _, field := range []string{"clusterIP", "clusterIPs"} {
+				if value, found, _ := unstructured.NestedFieldCopy(existing.Object, "spec", field); found {
+					if err := unstructured.SetNestedField(object.Object, value, "spec", field); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	// A no-op update keeps the resourceVersion, so "unchanged" is still reported correctly.
+	return client.Update(ctx, object, metav1.UpdateOptions{FieldManager: receiver.fieldManager})
+}
+
+// isApplyUnsupported reports whether err means the server does not know the apply patch type.
+func isApplyUnsupported(err error) bool {
+	return apierrors.IsUnsupportedMediaType(err) || apierrors.IsNotAcceptable(err) || apierrors.IsMethodNotSupported(err)
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const manifest = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-conf
+data:
+  nginx.conf: worker_processes 1;
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx-demo
+spec:
+  selector:
+    matchLabels: {app: nginx-demo}
+  template:
+    metadata:
+      labels: {app: nginx-demo}
+    spec:
+      containers:
+      - name: web
+        image: nginx
+---
+`
+
+// newTestApplyController returns an ApplyController whose dynamic client shares the objects of clientset.
+func newTestApplyController(clientset *fake.Clientset) (*ApplyController, *dynamicfake.FakeDynamicClient) {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme.Scheme, nil)
+	dynamicClient.PrependReactor("*", "*", k8stesting.ObjectReaction(clientset.Tracker()))
+	return NewApplyController(clientset, dynamicClient, testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme), "test"), dynamicClient
+}
+
+func TestDecodeManifests(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "documents of any kind", manifest: manifest + "apiVersion: example.com/v1\nkind: Widget\nmetadata: {name: w}\n", want: []string{"ConfigMap", "Deployment", "Widget"}},
+		{name: "field of the wrong type", manifest: "apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: d}\nspec: {replicas: three}\n", wantErr: true},
+		{name: "invalid yaml", manifest: "kind: [", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			objects, err := DecodeManifests(strings.NewReader(test.manifest))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("DecodeManifests() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeManifests() error = %v", err)
+			}
+			var kinds []string
+			for _, object := range objects {
+				kinds = append(kinds, object.GetKind())
+			}
+			if strings.Join(kinds, ",") != strings.Join(test.want, ",") {
+				t.Errorf("DecodeManifests() kinds = %v, want %v", kinds, test.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	applyController, dynamicClient := newTestApplyController(clientset)
+	objects, err := DecodeManifests(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{"configmap/nginx-conf created", "deployment.apps/nginx-demo created"} {
+		applied, err := applyController.Apply(ctx, objects[i], "demo")
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if applied.String() != want || applied.Namespace != "demo" {
+			t.Errorf("Apply() = %s in %q, want %s in demo", applied, applied.Namespace, want)
+		}
+	}
+	if _, err := clientset.CoreV1().ConfigMaps("demo").Get(ctx, "nginx-conf", metav1.GetOptions{}); err != nil {
+		t.Errorf("configmap not stored: %v", err)
+	}
+	for _, action := range dynamicClient.Actions() {
+		if patch, ok := action.(k8stesting.PatchActionImpl); ok {
+			if body := string(patch.GetPatch()); strings.Contains(body, "creationTimestamp") || strings.Contains(body, "status") {
+				t.Errorf("apply sent fields missing from the manifest: %s", body)
+			}
+		}
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		forceConflicts bool
+	}{
+		{name: "conflicts fail by default"},
+		{name: "forced", forceConflicts: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			applyController, _ := newTestApplyController(fake.NewClientset())
+
+			options := applyController.WithForceConflicts(test.forceConflicts).applyOptions()
+			if options.Force == nil || *options.Force != test.forceConflicts || options.FieldManager != "test" {
+				t.Errorf("applyOptions() = %+v, want force %t for manager test", options, test.forceConflicts)
+			}
+		})
+	}
+}
+
+func TestApplyUnknownKind(t *testing.T) {
+	objects, err := DecodeManifests(strings.NewReader("apiVersion: example.com/v1\nkind: Widget\nmetadata: {name: w}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyController, _ := newTestApplyController(fake.NewClientset())
+
+	if _, err := applyController.Apply(context.Background(), objects[0], "demo"); !errors.Is(err, errs.NotFound) {
+		t.Errorf("Apply() error = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"log"
+)
+
+// AutoscalerController manages the autoscaling/v2 HorizontalPodAutoscalers of deployments.
+// An autoscaler has the name of its deployment and is owned by it, so it goes away with the deployment.
+type AutoscalerController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+}
+
+func NewAutoscalerController(clientset kubernetes.Interface, options ...Option) *AutoscalerController {
+	return &AutoscalerController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+// NewAutoscaler builds the autoscaler of the deployment name, like "kubectl autoscale deployment NAME".
+func NewAutoscaler(namespace, name string, options *AutoscalerOptions) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: appsv1.SchemeGroupVersion.String(),
+				Kind:       "Deployment",
+				Name:       name,
+			},
+			MinReplicas: options.minReplicas(),
+			MaxReplicas: options.MaxReplicas,
+			Metrics:     options.metrics(),
+			Behavior:    options.Behavior,
+		},
+	}
+}
+
+// EnsureAutoscaler creates the autoscaler of the deployment name, or brings the spec of the existing one in line,
+// leaving alone the behavior fields the options don't set. The deployment must exist.
+// Utilization metrics of resources the containers do not request are logged, the autoscaler cannot compute them.
+func (receiver *AutoscalerController) EnsureAutoscaler(ctx context.Context, namespace, name string, options *AutoscalerOptions) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid autoscaler %s/%s: %w", namespace, name, err)
+	}
+	deployment, err := receiver.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get deployment %s/%s", namespace, name)
+	}
+	for _, resourceName := range unrequestedResources(deployment, options.metrics()) {
+		log.Printf("warning: containers of deployment %s/%s do not request %s, its utilization cannot be computed\n", namespace, name, resourceName)
+	}
+
+	autoscaler := NewAutoscaler(namespace, name, options)
+	autoscaler.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))}
+	autoscalersClient := receiver.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace)
+	result, created, err := createOrUpdate(ctx, receiver.backoff,
+		func(ctx context.Context) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+			return autoscalersClient.Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+			return autoscalersClient.Create(ctx, autoscaler, metav1.CreateOptions{})
+		},
+		func(ctx context.Context, autoscaler *autoscalingv2.HorizontalPodAutoscaler) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+			return autoscalersClient.Update(ctx, autoscaler, metav1.UpdateOptions{})
+		},
+		func(existing *autoscalingv2.HorizontalPodAutoscaler) error {
+			existing.Spec.ScaleTargetRef = autoscaler.Spec.ScaleTargetRef
+			existing.Spec.MinReplicas = autoscaler.Spec.MinReplicas
+			existing.Spec.MaxReplicas = autoscaler.Spec.MaxReplicas
+			existing.Spec.Metrics = autoscaler.Spec.Metrics
+			existing.Spec.Behavior = mergeBehavior(existing.Spec.Behavior, autoscaler.Spec.Behavior)
+			return nil
+		})
+	if err != nil {
+		return nil, errs.Wrapf(err, "ensure autoscaler %s/%s", namespace, name)
+	}
+	log.Printf("ensured autoscaler %s/%s (created: %t)\n", namespace, name, created)
+
+	return result, nil
+}
+
+func (receiver *AutoscalerController) GetAutoscaler(ctx context.Context, namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	autoscaler, err := receiver.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get autoscaler %s/%s", namespace, name)
+	}
+
+	return autoscaler, nil
+}
+
+func (receiver *AutoscalerController) ListAutoscalers(ctx context.Context, namespace string) (*autoscalingv2.HorizontalPodAutoscalerList, error) {
+	list, err := paging.List(ctx, receiver.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list autoscalers in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// UpdateAutoscaler lets mutate change the replica bounds, metrics or behavior of an autoscaler.
+// The horizontal pod autoscaler controller only acts on them at its next sync.
+func (receiver *AutoscalerController) UpdateAutoscaler(ctx context.Context, namespace, name string, mutate MutateFunc[*autoscalingv2.HorizontalPodAutoscaler]) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	log.Printf("Updating autoscaler: namespace: %s, name: %s\n", namespace, name)
+	autoscaler, err := updateNamed(ctx, receiver.backoff, receiver.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update autoscaler %s/%s", namespace, name)
+	}
+
+	return autoscaler, nil
+}
+
+// DeleteAutoscaler deletes the autoscaler, the deployment keeps its current replicas.
+func (receiver *AutoscalerController) DeleteAutoscaler(ctx context.Context, namespace, name string) error {
+	log.Printf("Deleting autoscaler: namespace: %s, name: %s\n", namespace, name)
+	if err := receiver.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return errs.Wrapf(err, "delete autoscaler %s/%s", namespace, name)
+	}
+
+	return nil
+}
+
+// AutoscalerStatus is what an autoscaler last saw and decided, like "kubectl describe hpa".
+type AutoscalerStatus struct {
+	Name            string
+	Target          string // e.g. "Deployment/nginx-demo".
+	MinReplicas     int32
+	MaxReplicas     int32
+	CurrentReplicas int32
+	DesiredReplicas int32
+	LastScaleTime   *metav1.Time
+	Metrics         []AutoscalerMetric
+	Conditions      []autoscalingv2.HorizontalPodAutoscalerCondition // AbleToScale, ScalingActive, ScalingLimited.
+}
+
+// AutoscalerMetric is one metric of an autoscaler, its values formatted like "45%" or "120m".
+type AutoscalerMetric struct {
+	Name    string // e.g. "resource cpu" or "pods http_requests_per_second".
+	Current string // "<unknown>" until the metric could be read.
+	Target  string
+}
+
+// AutoscalerStatus reads the status of the autoscaler, see AutoscalerStatusOf.
+func (receiver *AutoscalerController) AutoscalerStatus(ctx context.Context, namespace, name string) (*AutoscalerStatus, error) {
+	autoscaler, err := receiver.GetAutoscaler(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return AutoscalerStatusOf(autoscaler), nil
+}
+
+// AutoscalerStatusOf pairs the metrics of the spec of autoscaler with the values of its status.
+func AutoscalerStatusOf(autoscaler *autoscalingv2.HorizontalPodAutoscaler) *AutoscalerStatus {
+	status := &AutoscalerStatus{
+		Name:            autoscaler.Name,
+		Target:          autoscaler.Spec.ScaleTargetRef.Kind + "/" + autoscaler.Spec.ScaleTargetRef.Name,
+		MinReplicas:     1,
+		MaxReplicas:     autoscaler.Spec.MaxReplicas,
+		CurrentReplicas: autoscaler.Status.CurrentReplicas,
+		DesiredReplicas: autoscaler.Status.DesiredReplicas,
+		LastScaleTime:   autoscaler.Status.LastScaleTime,
+		Conditions:      autoscaler.Status.Conditions,
+	}
+	if autoscaler.Spec.MinReplicas != nil {
+		status.MinReplicas = *autoscaler.Spec.MinReplicas
+	}
+	for i, spec := range autoscaler.Spec.Metrics {
+		metric := AutoscalerMetric{Name: metricName(spec), Current: "<unknown>", Target: metricTarget(spec)}
+		// The status lists the metrics in the order of the spec, once all of them could be read.
+		if len(autoscaler.Status.CurrentMetrics) == len(autoscaler.Spec.Metrics) {
+			if current := metricCurrent(autoscaler.Status.CurrentMetrics[i]); current != nil {
+				metric.Current = formatMetricValue(current.AverageUtilization, current.AverageValue, current.Value)
+			}
+		}
+		status.Metrics = append(status.Metrics, metric)
+	}
+
+	return status
+}
+
+func metricName(spec autoscalingv2.MetricSpec) string {
+	switch spec.Type {
+	case autoscalingv2.ResourceMetricSourceType:
+		return "resource " + string(spec.Resource.Name)
+	case autoscalingv2.ContainerResourceMetricSourceType:
+		return fmt.Sprintf("resource %s of container %s", spec.ContainerResource.Name, spec.ContainerResource.Container)
+	case autoscalingv2.PodsMetricSourceType:
+		return "pods " + spec.Pods.Metric.Name
+	case autoscalingv2.ObjectMetricSourceType:
+		return fmt.Sprintf("object %s on %s/%s", spec.Object.Metric.Name, spec.Object.DescribedObject.Kind, spec.Object.DescribedObject.Name)
+	case autoscalingv2.ExternalMetricSourceType:
+		return "external " + spec.External.Metric.Name
+	}
+	return string(spec.Type)
+}
+
+func metricTarget(spec autoscalingv2.MetricSpec) string {
+	target := metricSpecTarget(&spec)
+	if target == nil {
+		return "<unknown>"
+	}
+	return formatMetricValue(target.AverageUtilization, target.AverageValue, target.Value)
+}
+
+func metricCurrent(status autoscalingv2.MetricStatus) *autoscalingv2.MetricValueStatus {
+	switch {
+	case status.Resource != nil:
+		return &status.Resource.Current
+	case status.ContainerResource != nil:
+		return &status.ContainerResource.Current
+	case status.Pods != nil:
+		return &status.Pods.Current
+	case status.Object != nil:
+		return &status.Object.Current
+	case status.External != nil:
+		return &status.External.Current
+	}
+	return nil
+}
+
+// formatMetricValue formats a target or current value, averages are marked as such.
+func formatMetricValue(averageUtilization *int32, averageValue, value *resource.Quantity) string {
+	switch {
+	case averageUtilization != nil:
+		return fmt.Sprintf("%d%%", *averageUtilization)
+	case averageValue != nil:
+		return averageValue.String() + " (avg)"
+	case value != nil:
+		return value.String()
+	}
+	return "<unknown>"
+}
+
+// unrequestedResources lists the resources of the utilization metrics that some container of deployment does not request.
+func unrequestedResources(deployment *appsv1.Deployment, metrics []autoscalingv2.MetricSpec) []apiv1.ResourceName {
+	var unrequested []apiv1.ResourceName
+	for _, metric := range metrics {
+		if metric.Type != autoscalingv2.ResourceMetricSourceType || metric.Resource == nil || metric.Resource.Target.Type != autoscalingv2.UtilizationMetricType {
+			continue
+		}
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			if _, ok := container.Resources.Requests[metric.Resource.Name]; !ok {
+				unrequested = append(unrequested, metric.Resource.Name)
+				break
+			}
+		}
+	}
+	return unrequested
+}
+
+// mergeBehavior sets the fields of desired on current. The API server fills in the rest of a behavior,
+// keeping them avoids rewriting the autoscaler on every call.
+func mergeBehavior(current, desired *autoscalingv2.HorizontalPodAutoscalerBehavior) *autoscalingv2.HorizontalPodAutoscalerBehavior {
+	if desired == nil {
+		return current
+	}
+	if current == nil {
+		return desired
+	}
+	current.ScaleUp = mergeScalingRules(current.ScaleUp, desired.ScaleUp)
+	current.ScaleDown = mergeScalingRules(current.ScaleDown, desired.ScaleDown)
+	return current
+}
+
+func mergeScalingRules(current, desired *autoscalingv2.HPAScalingRules) *autoscalingv2.HPAScalingRules {
+	if desired == nil {
+		return current
+	}
+	if current == nil {
+		return desired
+	}
+	if desired.StabilizationWindowSeconds != nil {
+		current.StabilizationWindowSeconds = desired.StabilizationWindowSeconds
+	}
+	if desired.SelectPolicy != nil {
+		current.SelectPolicy = desired.SelectPolicy
+	}
+	if len(desired.Policies) > 0 {
+		current.Policies = desired.Policies
+	}
+	if desired.Tolerance != nil {
+		current.Tolerance = desired.Tolerance
+	}
+	return current
+}
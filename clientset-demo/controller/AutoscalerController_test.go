@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEnsureAutoscaler(t *testing.T) {
+	maxPolicy := autoscalingv2.MaxChangePolicySelect
+	tests := []struct {
+		name    string
+		options *AutoscalerOptions
+		// serverDefaults fills in the behavior fields the API server defaults on create.
+		serverDefaults func(*autoscalingv2.HorizontalPodAutoscalerBehavior) *autoscalingv2.HorizontalPodAutoscalerBehavior
+	}{
+		{
+			name:    "defaults",
+			options: &AutoscalerOptions{MaxReplicas: 5},
+		},
+		{
+			name: "partial behavior",
+			options: &AutoscalerOptions{MaxReplicas: 5, Behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleDown: ScalingRules(60),
+			}},
+			serverDefaults: func(behavior *autoscalingv2.HorizontalPodAutoscalerBehavior) *autoscalingv2.HorizontalPodAutoscalerBehavior {
+				behavior.ScaleUp = ScalingRules(0, PercentPolicy(100, 15), PodsPolicy(4, 15))
+				behavior.ScaleUp.SelectPolicy = &maxPolicy
+				behavior.ScaleDown.SelectPolicy = &maxPolicy
+				behavior.ScaleDown.Policies = []autoscalingv2.HPAScalingPolicy{PercentPolicy(100, 15)}
+				return behavior
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewClientset(NewDeployment("demo", "nginx-demo", NginxDeploymentOptions()))
+			controller := NewAutoscalerController(clientset)
+
+			created, err := controller.EnsureAutoscaler(ctx, "demo", "nginx-demo", test.options)
+			if err != nil {
+				t.Fatalf("EnsureAutoscaler() error = %v", err)
+			}
+			if created.Spec.MinReplicas == nil || *created.Spec.MinReplicas != 1 {
+				t.Errorf("min replicas = %v, want 1", created.Spec.MinReplicas)
+			}
+			if want := []autoscalingv2.MetricSpec{DefaultAutoscalerMetric()}; !reflect.DeepEqual(created.Spec.Metrics, want) {
+				t.Errorf("metrics = %+v, want %+v", created.Spec.Metrics, want)
+			}
+			if test.serverDefaults != nil {
+				created.Spec.Behavior = test.serverDefaults(created.Spec.Behavior)
+				if _, err := clientset.AutoscalingV2().HorizontalPodAutoscalers("demo").Update(ctx, created, metav1.UpdateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			clientset.ClearActions()
+
+			if _, err := controller.EnsureAutoscaler(ctx, "demo", "nginx-demo", test.options); err != nil {
+				t.Fatalf("second EnsureAutoscaler() error = %v", err)
+			}
+			if updates := countActions(clientset, "update", "horizontalpodautoscalers"); updates != 0 {
+				t.Errorf("EnsureAutoscaler() of an autoscaler in line sent %d updates, want 0", updates)
+			}
+		})
+	}
+}
+
+func TestMergeBehavior(t *testing.T) {
+	current := &autoscalingv2.HorizontalPodAutoscalerBehavior{
+		ScaleUp:   ScalingRules(0, PodsPolicy(4, 15)),
+		ScaleDown: ScalingRules(300, PercentPolicy(100, 15)),
+	}
+	desired := &autoscalingv2.HorizontalPodAutoscalerBehavior{ScaleDown: ScalingRules(60)}
+
+	got := mergeBehavior(current.DeepCopy(), desired)
+	want := current.DeepCopy()
+	want.ScaleDown.StabilizationWindowSeconds = desired.ScaleDown.StabilizationWindowSeconds
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeBehavior() = %+v, want %+v", got, want)
+	}
+	if got := mergeBehavior(current, nil); got != current {
+		t.Errorf("mergeBehavior() without desired behavior = %+v, want the current one", got)
+	}
+}
+
+func TestAutoscalerOptionsValidate(t *testing.T) {
+	two := int32(2)
+	tests := []struct {
+		name    string
+		options AutoscalerOptions
+		wantErr bool
+	}{
+		{name: "default metric", options: AutoscalerOptions{MaxReplicas: 5}},
+		{name: "resource and pods metrics", options: AutoscalerOptions{MaxReplicas: 5, Metrics: []autoscalingv2.MetricSpec{
+			ResourceUtilizationMetric("cpu", 60), PodsMetric("requests", resource.MustParse("10")),
+		}}},
+		{name: "no max replicas", options: AutoscalerOptions{}, wantErr: true},
+		{name: "min above max", options: AutoscalerOptions{MinReplicas: &two, MaxReplicas: 1}, wantErr: true},
+		{name: "missing type", options: AutoscalerOptions{MaxReplicas: 5, Metrics: []autoscalingv2.MetricSpec{{}}}, wantErr: true},
+		{name: "resource type without resource source", options: AutoscalerOptions{MaxReplicas: 5, Metrics: []autoscalingv2.MetricSpec{
+			{Type: autoscalingv2.ResourceMetricSourceType},
+		}}, wantErr: true},
+		{name: "source of another type", options: AutoscalerOptions{MaxReplicas: 5, Metrics: []autoscalingv2.MetricSpec{
+			{Type: autoscalingv2.ExternalMetricSourceType, Pods: PodsMetric("requests", resource.MustParse("10")).Pods},
+		}}, wantErr: true},
+		{name: "target without type", options: AutoscalerOptions{MaxReplicas: 5, Metrics: []autoscalingv2.MetricSpec{
+			{Type: autoscalingv2.ResourceMetricSourceType, Resource: &autoscalingv2.ResourceMetricSource{Name: "cpu"}},
+		}}, wantErr: true},
+		{name: "utilization target without value", options: AutoscalerOptions{MaxReplicas: 5, Metrics: []autoscalingv2.MetricSpec{
+			{Type: autoscalingv2.ResourceMetricSourceType, Resource: &autoscalingv2.ResourceMetricSource{
+				Name: "cpu", Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType},
+			}},
+		}}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.options.Validate(); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
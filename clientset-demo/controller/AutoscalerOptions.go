@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"fmt"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AutoscalerOptions describes the autoscaling/v2 HorizontalPodAutoscaler built by NewAutoscaler.
+// The metrics come from the builders below, e.g.
+//
+//	&AutoscalerOptions{
+//		MaxReplicas: 10,
+//		Metrics: []autoscalingv2.MetricSpec{
+//			ResourceUtilizationMetric(apiv1.ResourceCPU, 70),
+//			PodsMetric("http_requests_per_second", resource.MustParse("100")),
+//		},
+//		Behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+//			ScaleDown: ScalingRules(300, PercentPolicy(10, 60)),
+//		},
+//	}
+type AutoscalerOptions struct {
+	MinReplicas *int32 // defaults to 1.
+	MaxReplicas int32
+	// Metrics the desired replicas are computed from, the highest proposal wins.
+	// Defaults to DefaultAutoscalerMetric.
+	Metrics []autoscalingv2.MetricSpec
+	// Behavior limits how fast the replicas change, defaults to scaling up at once and down after 5 minutes.
+	// Only the fields set are enforced on an existing autoscaler, the others keep their value.
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior
+}
+
+// DefaultAutoscalerMetric is the metric of an autoscaler without any, 80% CPU utilization like the API server's default.
+func DefaultAutoscalerMetric() autoscalingv2.MetricSpec {
+	return ResourceUtilizationMetric(apiv1.ResourceCPU, 80)
+}
+
+// minReplicas is MinReplicas, defaulted like the API server does.
+func (o *AutoscalerOptions) minReplicas() *int32 {
+	if o.MinReplicas != nil {
+		return o.MinReplicas
+	}
+	minReplicas := int32(1)
+	return &minReplicas
+}
+
+// metrics is Metrics, defaulted like the API server does.
+func (o *AutoscalerOptions) metrics() []autoscalingv2.MetricSpec {
+	if len(o.Metrics) > 0 {
+		return o.Metrics
+	}
+	return []autoscalingv2.MetricSpec{DefaultAutoscalerMetric()}
+}
+
+func (o *AutoscalerOptions) Validate() error {
+	if o.MaxReplicas < 1 {
+		return fmt.Errorf("max replicas must be at least 1, got %d", o.MaxReplicas)
+	}
+	if o.MinReplicas != nil && (*o.MinReplicas < 1 || *o.MinReplicas > o.MaxReplicas) {
+		return fmt.Errorf("min replicas must be between 1 and %d, got %d", o.MaxReplicas, *o.MinReplicas)
+	}
+	for i, metric := range o.Metrics {
+		if metric.Type == "" {
+			return fmt.Errorf("metrics[%d]: metric type is required", i)
+		}
+		target := metricSpecTarget(&metric)
+		if target == nil {
+			return fmt.Errorf("metrics[%d]: the %s source of a %s metric is required", i, metric.Type, metric.Type)
+		}
+		if err := validateMetricTarget(target); err != nil {
+			return fmt.Errorf("metrics[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// metricSpecTarget returns the target of the source matching the type of spec, nil when that source is missing.
+func metricSpecTarget(spec *autoscalingv2.MetricSpec) *autoscalingv2.MetricTarget {
+	switch {
+	case spec.Type == autoscalingv2.ResourceMetricSourceType && spec.Resource != nil:
+		return &spec.Resource.Target
+	case spec.Type == autoscalingv2.ContainerResourceMetricSourceType && spec.ContainerResource != nil:
+		return &spec.ContainerResource.Target
+	case spec.Type == autoscalingv2.PodsMetricSourceType && spec.Pods != nil:
+		return &spec.Pods.Target
+	case spec.Type == autoscalingv2.ObjectMetricSourceType && spec.Object != nil:
+		return &spec.Object.Target
+	case spec.Type == autoscalingv2.ExternalMetricSourceType && spec.External != nil:
+		return &spec.External.Target
+	}
+	return nil
+}
+
+// validateMetricTarget checks that target sets the value its type compares against.
+func validateMetricTarget(target *autoscalingv2.MetricTarget) error {
+	switch target.Type {
+	case autoscalingv2.UtilizationMetricType:
+		if target.AverageUtilization == nil || *target.AverageUtilization < 1 {
+			return fmt.Errorf("a %s target needs a positive average utilization", target.Type)
+		}
+	case autoscalingv2.AverageValueMetricType:
+		if target.AverageValue == nil {
+			return fmt.Errorf("an %s target needs an average value", target.Type)
+		}
+	case autoscalingv2.ValueMetricType:
+		if target.Value == nil {
+			return fmt.Errorf("a %s target needs a value", target.Type)
+		}
+	case "":
+		return fmt.Errorf("target type is required")
+	default:
+		return fmt.Errorf("unknown target type %q", target.Type)
+	}
+	return nil
+}
+
+// ResourceUtilizationMetric targets the average usage of a resource of the pods, in percent of their requests.
+// The containers must request the resource, otherwise the HPA cannot compute the utilization.
+func ResourceUtilizationMetric(name apiv1.ResourceName, percent int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: &percent,
+			},
+		},
+	}
+}
+
+// ResourceAverageValueMetric targets the average usage of a resource of the pods, e.g. 512Mi of memory.
+func ResourceAverageValueMetric(name apiv1.ResourceName, averageValue resource.Quantity) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2.MetricTarget{
+				Type:         autoscalingv2.AverageValueMetricType,
+				AverageValue: &averageValue,
+			},
+		},
+	}
+}
+
+// PodsMetric targets the average of a custom metric of the pods, served by a custom.metrics.k8s.io adapter.
+func PodsMetric(name string, averageValue resource.Quantity) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.PodsMetricSourceType,
+		Pods: &autoscalingv2.PodsMetricSource{
+			Metric: autoscalingv2.MetricIdentifier{Name: name},
+			Target: autoscalingv2.MetricTarget{
+				Type:         autoscalingv2.AverageValueMetricType,
+				AverageValue: &averageValue,
+			},
+		},
+	}
+}
+
+// ObjectMetric targets a custom metric describing another object of the namespace,
+// e.g. the requests per second of an Ingress.
+func ObjectMetric(name string, object autoscalingv2.CrossVersionObjectReference, value resource.Quantity) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ObjectMetricSourceType,
+		Object: &autoscalingv2.ObjectMetricSource{
+			DescribedObject: object,
+			Metric:          autoscalingv2.MetricIdentifier{Name: name},
+			Target: autoscalingv2.MetricTarget{
+				Type:  autoscalingv2.ValueMetricType,
+				Value: &value,
+			},
+		},
+	}
+}
+
+// ExternalMetric targets a metric from outside the cluster, e.g. the length of a queue, served by an
+// external.metrics.k8s.io adapter. The value is divided by the replicas; selector narrows down the series.
+func ExternalMetric(name string, selector map[string]string, averageValue resource.Quantity) autoscalingv2.MetricSpec {
+	metric := autoscalingv2.MetricIdentifier{Name: name}
+	if len(selector) > 0 {
+		metric.Selector = &metav1.LabelSelector{MatchLabels: selector}
+	}
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: &autoscalingv2.ExternalMetricSource{
+			Metric: metric,
+			Target: autoscalingv2.MetricTarget{
+				Type:         autoscalingv2.AverageValueMetricType,
+				AverageValue: &averageValue,
+			},
+		},
+	}
+}
+
+// ScalingRules builds the rules of one direction of a behavior: recommendations of the last
+// stabilizationWindowSeconds are considered and, with several policies, the one allowing the biggest change wins.
+func ScalingRules(stabilizationWindowSeconds int32, policies ...autoscalingv2.HPAScalingPolicy) *autoscalingv2.HPAScalingRules {
+	return &autoscalingv2.HPAScalingRules{
+		StabilizationWindowSeconds: &stabilizationWindowSeconds,
+		Policies:                   policies,
+	}
+}
+
+// PodsPolicy allows changing the replicas by at most pods within periodSeconds.
+func PodsPolicy(pods, periodSeconds int32) autoscalingv2.HPAScalingPolicy {
+	return autoscalingv2.HPAScalingPolicy{Type: autoscalingv2.PodsScalingPolicy, Value: pods, PeriodSeconds: periodSeconds}
+}
+
+// PercentPolicy allows changing the replicas by at most percent of the current ones within periodSeconds.
+func PercentPolicy(percent, periodSeconds int32) autoscalingv2.HPAScalingPolicy {
+	return autoscalingv2.HPAScalingPolicy{Type: autoscalingv2.PercentScalingPolicy, Value: percent, PeriodSeconds: periodSeconds}
+}
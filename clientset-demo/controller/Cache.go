@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"time"
+)
+
+const (
+	// ByLabelIndex indexes objects by each of their "key=value" labels.
+	ByLabelIndex = "byLabel"
+	// ByOwnerIndex indexes objects by the UID of each of their owners.
+	ByOwnerIndex = "byOwner"
+)
+
+// Cache is the shared-informer backed read layer for deployments, services and namespaces.
+// Objects are listed once, then kept fresh by watches, so reads are served locally.
+// Objects returned by the cache are shared and must not be modified.
+type Cache struct {
+	factory     informers.SharedInformerFactory
+	deployments cache.SharedIndexInformer
+	services    cache.SharedIndexInformer
+	namespaces  cache.SharedIndexInformer
+}
+
+// NewCache registers the informers; resync re-delivers every object to the event handlers
+// at that interval, 0 disables it.
+func NewCache(clientset kubernetes.Interface, resync time.Duration) (*Cache, error) {
+	factory := informers.NewSharedInformerFactory(clientset, resync)
+	c := &Cache{
+		factory:     factory,
+		deployments: factory.Apps().V1().Deployments().Informer(),
+		services:    factory.Core().V1().Services().Informer(),
+		namespaces:  factory.Core().V1().Namespaces().Informer(),
+	}
+	// The namespace index is registered by the typed informers already.
+	indexers := cache.Indexers{ByLabelIndex: labelIndexFunc, ByOwnerIndex: ownerIndexFunc}
+	for _, informer := range []cache.SharedIndexInformer{c.deployments, c.services, c.namespaces} {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Factory returns the underlying informer factory, to share its informers with event handlers.
+func (receiver *Cache) Factory() informers.SharedInformerFactory {
+	return receiver.factory
+}
+
+// Start runs the informers until ctx is done.
+func (receiver *Cache) Start(ctx context.Context) {
+	receiver.factory.Start(ctx.Done())
+}
+
+// WaitForCacheSync blocks until the initial list of every informer is in the cache.
+func (receiver *Cache) WaitForCacheSync(ctx context.Context) error {
+	for informerType, synced := range receiver.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("cache of %v did not sync: %w", informerType, context.Cause(ctx))
+		}
+	}
+	return nil
+}
+
+func (receiver *Cache) DeploymentLister() appslisters.DeploymentLister {
+	return appslisters.NewDeploymentLister(receiver.deployments.GetIndexer())
+}
+
+func (receiver *Cache) ServiceLister() corelisters.ServiceLister {
+	return corelisters.NewServiceLister(receiver.services.GetIndexer())
+}
+
+func (receiver *Cache) NamespaceLister() corelisters.NamespaceLister {
+	return corelisters.NewNamespaceLister(receiver.namespaces.GetIndexer())
+}
+
+// DeploymentsByLabel returns the deployments of all namespaces labeled key=value.
+func (receiver *Cache) DeploymentsByLabel(key, value string) ([]*appsv1.Deployment, error) {
+	return byIndex[*appsv1.Deployment](receiver.deployments, ByLabelIndex, key+"="+value)
+}
+
+// DeploymentsByOwner returns the deployments owned by the object with the given UID.
+func (receiver *Cache) DeploymentsByOwner(uid types.UID) ([]*appsv1.Deployment, error) {
+	return byIndex[*appsv1.Deployment](receiver.deployments, ByOwnerIndex, string(uid))
+}
+
+// ServicesByLabel returns the services of all namespaces labeled key=value.
+func (receiver *Cache) ServicesByLabel(key, value string) ([]*apiv1.Service, error) {
+	return byIndex[*apiv1.Service](receiver.services, ByLabelIndex, key+"="+value)
+}
+
+// ServicesByOwner returns the services owned by the object with the given UID.
+func (receiver *Cache) ServicesByOwner(uid types.UID) ([]*apiv1.Service, error) {
+	return byIndex[*apiv1.Service](receiver.services, ByOwnerIndex, string(uid))
+}
+
+// NamespacesByLabel returns the namespaces labeled key=value.
+func (receiver *Cache) NamespacesByLabel(key, value string) ([]*apiv1.Namespace, error) {
+	return byIndex[*apiv1.Namespace](receiver.namespaces, ByLabelIndex, key+"="+value)
+}
+
+func byIndex[T any](informer cache.SharedIndexInformer, indexName, value string) ([]T, error) {
+	items, err := informer.GetIndexer().ByIndex(indexName, value)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]T, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(T); ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+func labelIndexFunc(obj interface{}) ([]string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(accessor.GetLabels()))
+	for key, value := range accessor.GetLabels() {
+		keys = append(keys, key+"="+value)
+	}
+	return keys, nil
+}
+
+func ownerIndexFunc(obj interface{}) ([]string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(accessor.GetOwnerReferences()))
+	for _, owner := range accessor.GetOwnerReferences() {
+		keys = append(keys, string(owner.UID))
+	}
+	return keys, nil
+}
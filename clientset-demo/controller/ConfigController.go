@@ -1,40 +1,78 @@
 package controller
 
 import (
+	"clientset-demo/errs"
+	"common/factory"
 	"flag"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
-	"path/filepath"
+	"k8s.io/client-go/rest"
 )
 
 type ConfigController struct {
+	options factory.Options
+	factory *factory.Factory
 }
 
-func (receiver *ConfigController) GetClientset() (*kubernetes.Clientset, error) {
-	// 加载kubeconfig配置, 默认: ~/.kube/config.
-	// 通过kubernetes.NewForConfig(config)获取到clientset对象.
+// GetFactory parses the command line once and returns the client factory built from it.
+func (receiver *ConfigController) GetFactory() (*factory.Factory, error) {
+	if receiver.factory != nil {
+		return receiver.factory, nil
+	}
+	receiver.options.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	// 加载kubeconfig配置, 默认: $KUBECONFIG合并后的配置或~/.kube/config, 在pod内运行时使用in-cluster配置.
+	f, err := factory.New(&receiver.options)
+	if err != nil {
+		return nil, &errs.Error{Kind: errs.InvalidConfig, Op: "load kubeconfig", Err: err}
+	}
+	receiver.factory = f
+
+	return f, nil
+}
+
+func (receiver *ConfigController) GetClientset() (kubernetes.Interface, error) {
+	// 通过factory获取到clientset对象.
 	// 通过clientset获取到组信息:
 	// 	* AppsV1 <=> apiVersion: v1
 	// 	* apiVersion: v1 <=> AppsV1Interface
 	// 	* AppsV1Interface <=> [ControllerRevisionsGetter,DaemonSetsGetter,DeploymentsGetter,ReplicaSetsGetter,StatefulSetsGetter]
 	// 	* DeploymentsGetter <=> DeploymentInterface
 	//  * DeploymentInterface <=> Create(ctx context.Context, deployment *v1.Deployment, opts metav1.CreateOptions) (*v1.Deployment, error)
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		// kubeconfig = flag.String("kubeconfig", filepath.Join(constant.KubeConfigHomeDir, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+	f, err := receiver.GetFactory()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := f.Clientset()
+	if err != nil {
+		return nil, &errs.Error{Kind: errs.InvalidConfig, Op: "create clientset", Err: err}
 	}
-	flag.Parse()
 
-	// config -> clientset.
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	return clientset, nil
+}
+
+// GetRESTConfig returns a copy of the resolved rest config, needed by the streaming calls exec and port-forward.
+func (receiver *ConfigController) GetRESTConfig() (*rest.Config, error) {
+	f, err := receiver.GetFactory()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	return f.RESTConfig(), nil
+}
+
+// PageSize returns the number of objects fetched per list request given by --page-size.
+func (receiver *ConfigController) PageSize() int64 {
+	return receiver.options.PageSize
+}
+
+// Namespace returns the namespace given by --namespace, else the one set on the selected context or the pod's
+// when running in-cluster. Otherwise, or when the kubeconfig cannot be resolved, it returns defaultNamespace.
+func (receiver *ConfigController) Namespace(defaultNamespace string) string {
+	namespace, ok, err := receiver.options.ExplicitNamespace()
+	if err != nil || !ok {
+		return defaultNamespace
 	}
-	clientset, err := kubernetes.NewForConfig(config)
 
-	return clientset, err
+	return namespace
 }
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"log"
+	"sort"
+)
+
+// ConfigHashAnnotation on the pod template of a deployment holds the hash of the configmaps and secrets it uses.
+// Pods don't restart when a mounted configmap changes, a new hash changes the template and rolls them.
+const ConfigHashAnnotation = "clientset-demo/config-hash"
+
+// ConfigHash is the hex SHA-256 of the data of configMaps and secrets. It does not depend on their order,
+// on their metadata or on the order of their keys.
+func ConfigHash(configMaps []*apiv1.ConfigMap, secrets []*apiv1.Secret) string {
+	type source struct {
+		name string
+		data map[string][]byte
+	}
+	sources := make([]source, 0, len(configMaps)+len(secrets))
+	for _, configMap := range configMaps {
+		data := make(map[string][]byte, len(configMap.Data)+len(configMap.BinaryData))
+		for key, value := range configMap.Data {
+			data[key] = []byte(value)
+		}
+		for key, value := range configMap.BinaryData {
+			data[key] = value
+		}
+		sources = append(sources, source{name: "configmap/" + configMap.Name, data: data})
+	}
+	for _, secret := range secrets {
+		sources = append(sources, source{name: "secret/" + secret.Name, data: secret.Data})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].name < sources[j].name
+	})
+
+	h := sha256.New()
+	for _, source := range sources {
+		writeHashField(h, source.name)
+		keys := make([]string, 0, len(source.data))
+		for key := range source.data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeHashField(h, key)
+			writeHashField(h, string(source.data[key]))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeHashField writes value prefixed by its length, so that no two different inputs hash the same stream.
+func writeHashField(h hash.Hash, value string) {
+	fmt.Fprintf(h, "%d:%s", len(value), value)
+}
+
+// StampConfigHash sets ConfigHashAnnotation on the pod template of the deployment to the ConfigHash of the named
+// configmaps and secrets of its namespace. The deployment is only updated, and its pods rolled, when the hash changed.
+// Call it after changing the configmaps or secrets, e.g. after ConfigMapController.EnsureConfigMap.
+func (receiver *DeploymentController) StampConfigHash(ctx context.Context, namespace, name string, configMapNames, secretNames []string) (*appsv1.Deployment, error) {
+	configHash, err := fetchConfigHash(ctx, receiver.clientset, namespace, configMapNames, secretNames, false)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Stamping config hash %s on deployment %s/%s\n", configHash, namespace, name)
+	return receiver.UpdateDeployment(ctx, namespace, name, func(deployment *appsv1.Deployment) error {
+		stampConfigHash(&deployment.Spec.Template, configHash)
+		return nil
+	})
+}
+
+// fetchConfigHash reads the named configmaps and secrets of namespace and returns their ConfigHash.
+// With skipMissing the ones that don't exist yet are left out, otherwise they fail with errs.NotFound.
+func fetchConfigHash(ctx context.Context, clientset kubernetes.Interface, namespace string, configMapNames, secretNames []string, skipMissing bool) (string, error) {
+	configMaps := make([]*apiv1.ConfigMap, 0, len(configMapNames))
+	for _, configMapName := range configMapNames {
+		configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+		if skipMissing && apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", errs.Wrapf(err, "get configmap %s/%s", namespace, configMapName)
+		}
+		configMaps = append(configMaps, configMap)
+	}
+	secrets := make([]*apiv1.Secret, 0, len(secretNames))
+	for _, secretName := range secretNames {
+		secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if skipMissing && apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", errs.Wrapf(err, "get secret %s/%s", namespace, secretName)
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return ConfigHash(configMaps, secrets), nil
+}
+
+func stampConfigHash(template *apiv1.PodTemplateSpec, configHash string) {
+	template.Annotations = mergeStringMap(template.Annotations, map[string]string{ConfigHashAnnotation: configHash}, nil)
+}
+
+// podConfigSources returns, sorted, the configmaps and secrets spec mounts as volumes or reads environment variables from.
+func podConfigSources(spec *apiv1.PodSpec) (configMapNames, secretNames []string) {
+	configMaps, secrets := sets.New[string](), sets.New[string]()
+	for _, volume := range spec.Volumes {
+		switch {
+		case volume.ConfigMap != nil:
+			configMaps.Insert(volume.ConfigMap.Name)
+		case volume.Secret != nil:
+			secrets.Insert(volume.Secret.SecretName)
+		case volume.Projected != nil:
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMaps.Insert(source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					secrets.Insert(source.Secret.Name)
+				}
+			}
+		}
+	}
+	for _, container := range append(append([]apiv1.Container{}, spec.InitContainers...), spec.Containers...) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				configMaps.Insert(envFrom.ConfigMapRef.Name)
+			}
+			if envFrom.SecretRef != nil {
+				secrets.Insert(envFrom.SecretRef.Name)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMaps.Insert(env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secrets.Insert(env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+	return sets.List(configMaps), sets.List(secrets)
+}
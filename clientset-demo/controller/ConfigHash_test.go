@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func configMap(name string, data map[string]string) *apiv1.ConfigMap {
+	return &apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}, Data: data}
+}
+
+func TestCreateDeploymentConfigHash(t *testing.T) {
+	nginxConf := configMap("nginx-conf", map[string]string{"nginx.conf": "worker_processes 1;"})
+	tests := []struct {
+		name       string
+		configMaps []string
+		want       string
+		wantErr    error
+	}{
+		{name: "no config, no annotation"},
+		{name: "hash of the named configmaps", configMaps: []string{"nginx-conf"}, want: ConfigHash([]*apiv1.ConfigMap{nginxConf}, nil)},
+		{name: "missing configmap", configMaps: []string{"missing"}, wantErr: errs.NotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset(nginxConf)
+			options := NginxDeploymentOptions()
+			options.ConfigMaps = test.configMaps
+
+			deployment, err := NewDeploymentController(clientset).CreateDeployment(context.Background(), "demo", "nginx-demo", options)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("CreateDeployment() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateDeployment() error = %v", err)
+			}
+			if got := deployment.Spec.Template.Annotations[ConfigHashAnnotation]; got != test.want {
+				t.Errorf("config hash = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStampConfigHashAfterCreate(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset(configMap("nginx-conf", map[string]string{"nginx.conf": "worker_processes 1;"}))
+	controller := NewDeploymentController(clientset)
+	options := NginxDeploymentOptions()
+	options.ConfigMaps = []string{"nginx-conf"}
+	if _, err := controller.CreateDeployment(ctx, "demo", "nginx-demo", options); err != nil {
+		t.Fatalf("CreateDeployment() error = %v", err)
+	}
+
+	if _, err := controller.StampConfigHash(ctx, "demo", "nginx-demo", options.ConfigMaps, nil); err != nil {
+		t.Fatalf("StampConfigHash() error = %v", err)
+	}
+	if updates := countActions(clientset, "update", "deployments"); updates != 0 {
+		t.Errorf("StampConfigHash() of unchanged config sent %d updates, want 0", updates)
+	}
+}
+
+func TestPodConfigSources(t *testing.T) {
+	spec := &apiv1.PodSpec{
+		Volumes: []apiv1.Volume{
+			{Name: "conf", VolumeSource: apiv1.VolumeSource{ConfigMap: &apiv1.ConfigMapVolumeSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "nginx-conf"}}}},
+			{Name: "tls", VolumeSource: apiv1.VolumeSource{Secret: &apiv1.SecretVolumeSource{SecretName: "tls"}}},
+			{Name: "projected", VolumeSource: apiv1.VolumeSource{Projected: &apiv1.ProjectedVolumeSource{Sources: []apiv1.VolumeProjection{
+				{ConfigMap: &apiv1.ConfigMapProjection{LocalObjectReference: apiv1.LocalObjectReference{Name: "ca"}}},
+			}}}},
+			{Name: "scratch", VolumeSource: apiv1.VolumeSource{EmptyDir: &apiv1.EmptyDirVolumeSource{}}},
+		},
+		InitContainers: []apiv1.Container{{
+			EnvFrom: []apiv1.EnvFromSource{{SecretRef: &apiv1.SecretEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "db"}}}},
+		}},
+		Containers: []apiv1.Container{{
+			Env: []apiv1.EnvVar{
+				{Name: "LEVEL", ValueFrom: &apiv1.EnvVarSource{ConfigMapKeyRef: &apiv1.ConfigMapKeySelector{LocalObjectReference: apiv1.LocalObjectReference{Name: "nginx-conf"}, Key: "level"}}},
+				{Name: "PLAIN", Value: "1"},
+			},
+		}},
+	}
+
+	configMaps, secrets := podConfigSources(spec)
+	if want := []string{"ca", "nginx-conf"}; !slices.Equal(configMaps, want) {
+		t.Errorf("configmaps = %v, want %v", configMaps, want)
+	}
+	if want := []string{"db", "tls"}; !slices.Equal(secrets, want) {
+		t.Errorf("secrets = %v, want %v", secrets, want)
+	}
+}
+
+func TestApplyConfigHash(t *testing.T) {
+	nginxConf := configMap("nginx-conf", map[string]string{"nginx.conf": "worker_processes 1;"})
+	deployment := NewDeployment("demo", "nginx-demo", NginxDeploymentOptions())
+	deployment.Spec.Template.Spec.Volumes = []apiv1.Volume{
+		{Name: "conf", VolumeSource: apiv1.VolumeSource{ConfigMap: &apiv1.ConfigMapVolumeSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "nginx-conf"}}}},
+		{Name: "tls", VolumeSource: apiv1.VolumeSource{Secret: &apiv1.SecretVolumeSource{SecretName: "not-yet-created"}}},
+	}
+	tests := []struct {
+		name    string
+		enabled bool
+		want    string
+	}{
+		{name: "disabled", enabled: false},
+		{name: "enabled, missing sources left out", enabled: true, want: ConfigHash([]*apiv1.ConfigMap{nginxConf}, nil)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset(nginxConf)
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			object := &unstructured.Unstructured{Object: content}
+			object.SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind("Deployment")) // as decoded from a manifest.
+			applyController, _ := newTestApplyController(clientset)
+
+			if _, err := applyController.WithConfigHash(test.enabled).Apply(context.Background(), object, "demo"); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			stored, err := clientset.AppsV1().Deployments("demo").Get(context.Background(), "nginx-demo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("deployment not stored: %v", err)
+			}
+			if got := stored.Spec.Template.Annotations[ConfigHashAnnotation]; got != test.want {
+				t.Errorf("config hash = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
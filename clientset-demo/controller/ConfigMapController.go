@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+type ConfigMapController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+}
+
+func NewConfigMapController(clientset kubernetes.Interface, options ...Option) *ConfigMapController {
+	return &ConfigMapController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+// NewConfigMapFromFiles builds a configmap from local files, like "kubectl create configmap --from-file".
+// Every source is one of:
+//
+//	path/to/file      the key is the file name
+//	key=path/to/file  the key is given
+//	path/to/dir       every regular file directly in dir, keyed by its name; subdirectories are skipped
+//
+// UTF-8 files go to Data, the others to BinaryData.
+func NewConfigMapFromFiles(namespace, name string, sources ...string) (*apiv1.ConfigMap, error) {
+	files, err := readSourceFiles(sources)
+	if err != nil {
+		return nil, err
+	}
+	configMap := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Data: map[string]string{},
+	}
+	for key, content := range files {
+		if utf8.Valid(content) {
+			configMap.Data[key] = string(content)
+			continue
+		}
+		if configMap.BinaryData == nil {
+			configMap.BinaryData = map[string][]byte{}
+		}
+		configMap.BinaryData[key] = content
+	}
+
+	return configMap, nil
+}
+
+// readSourceFiles reads the "--from-file" sources described in NewConfigMapFromFiles, keyed by their data key.
+func readSourceFiles(sources []string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	add := func(key, path string) error {
+		if problems := validation.IsConfigMapKey(key); len(problems) > 0 {
+			return fmt.Errorf("invalid key %q for %s: %s", key, path, strings.Join(problems, ", "))
+		}
+		if _, ok := files[key]; ok {
+			return fmt.Errorf("duplicate key %q for %s", key, path)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[key] = content
+		return nil
+	}
+
+	for _, source := range sources {
+		key, path, keyed := strings.Cut(source, "=")
+		if !keyed {
+			path = source
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if !keyed {
+				key = filepath.Base(path)
+			}
+			if err := add(key, path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if keyed {
+			return nil, fmt.Errorf("cannot give a key to directory %s", path)
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			if err := add(entry.Name(), filepath.Join(path, entry.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func (receiver *ConfigMapController) CreateConfigMap(ctx context.Context, configMap *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+	log.Printf("Creating configmap: namespace: %s, name: %s\n", configMap.Namespace, configMap.Name)
+	result, err := receiver.clientset.CoreV1().ConfigMaps(configMap.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create configmap %s/%s", configMap.Namespace, configMap.Name)
+	}
+
+	return result, nil
+}
+
+// EnsureConfigMap creates the configmap, or replaces the data of the existing one with the data of configMap.
+// Labels and annotations are merged into the existing ones.
+func (receiver *ConfigMapController) EnsureConfigMap(ctx context.Context, configMap *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+	configMapsClient := receiver.clientset.CoreV1().ConfigMaps(configMap.Namespace)
+	result, created, err := createOrUpdate(ctx, receiver.backoff,
+		func(ctx context.Context) (*apiv1.ConfigMap, error) {
+			return configMapsClient.Get(ctx, configMap.Name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*apiv1.ConfigMap, error) {
+			return configMapsClient.Create(ctx, configMap, metav1.CreateOptions{})
+		},
+		func(ctx context.Context, configMap *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+			return configMapsClient.Update(ctx, configMap, metav1.UpdateOptions{})
+		},
+		func(existing *apiv1.ConfigMap) error {
+			existing.Labels = mergeStringMap(existing.Labels, configMap.Labels, nil)
+			existing.Annotations = mergeStringMap(existing.Annotations, configMap.Annotations, nil)
+			existing.Data = configMap.Data
+			existing.BinaryData = configMap.BinaryData
+			return nil
+		})
+	if err != nil {
+		return nil, errs.Wrapf(err, "ensure configmap %s/%s", configMap.Namespace, configMap.Name)
+	}
+	log.Printf("ensured configmap %s/%s (created: %t)\n", configMap.Namespace, configMap.Name, created)
+
+	return result, nil
+}
+
+func (receiver *ConfigMapController) GetConfigMap(ctx context.Context, namespace, name string) (*apiv1.ConfigMap, error) {
+	configMap, err := receiver.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get configmap %s/%s", namespace, name)
+	}
+
+	return configMap, nil
+}
+
+func (receiver *ConfigMapController) ListConfigMaps(ctx context.Context, namespace string) (*apiv1.ConfigMapList, error) {
+	list, err := paging.List(ctx, receiver.clientset.CoreV1().ConfigMaps(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list configmaps in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// UpdateConfigMap edits the data of a configmap with mutate. Mounted keys reach the pods after the kubelet
+// sync period, environment variables only on restart: see StampConfigHash to roll the consumers.
+func (receiver *ConfigMapController) UpdateConfigMap(ctx context.Context, namespace, name string, mutate MutateFunc[*apiv1.ConfigMap]) (*apiv1.ConfigMap, error) {
+	log.Printf("Updating configmap: namespace: %s, name: %s\n", namespace, name)
+	configMap, err := updateNamed(ctx, receiver.backoff, receiver.clientset.CoreV1().ConfigMaps(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update configmap %s/%s", namespace, name)
+	}
+
+	return configMap, nil
+}
+
+func (receiver *ConfigMapController) DeleteConfigMap(ctx context.Context, namespace, name string) error {
+	log.Printf("Deleting configmap: namespace: %s, name: %s\n", namespace, name)
+	if err := receiver.clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return errs.Wrapf(err, "delete configmap %s/%s", namespace, name)
+	}
+
+	return nil
+}
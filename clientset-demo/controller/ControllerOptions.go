@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"common/paging"
+	"context"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"time"
+)
+
+// controllerOptions are the settings every controller embeds, tuned by the Option arguments of its constructor.
+type controllerOptions struct {
+	backoff        wait.Backoff      // backoff between update retries on conflict.
+	pageSize       int64             // objects fetched per list request.
+	requestTimeout time.Duration     // bound of the work a controller starts on its own, e.g. a reconcile; 0 means none.
+	nodePortRange  utilnet.PortRange // range the ServiceController picks free node ports from.
+}
+
+// defaultRequestTimeout bounds the work a controller starts on its own unless WithRequestTimeout says otherwise.
+const defaultRequestTimeout = 30 * time.Second
+
+// Option tunes a controller built by one of the NewXxxController constructors.
+type Option func(*controllerOptions)
+
+// WithBackoff sets the backoff used by updates retrying on conflict, retry.DefaultRetry by default.
+func WithBackoff(backoff wait.Backoff) Option {
+	return func(o *controllerOptions) {
+		o.backoff = backoff
+	}
+}
+
+// WithPageSize sets the number of objects fetched per list request, paging.DefaultPageSize by default.
+func WithPageSize(pageSize int64) Option {
+	return func(o *controllerOptions) {
+		o.pageSize = pageSize
+	}
+}
+
+// WithRequestTimeout bounds the work a controller starts on its own rather than for a caller's ctx,
+// such as one reconcile of the ServiceReconciler. 0 means no bound, defaultRequestTimeout is the default.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *controllerOptions) {
+		o.requestTimeout = timeout
+	}
+}
+
+func newControllerOptions(options []Option) controllerOptions {
+	o := controllerOptions{
+		backoff:        retry.DefaultRetry,
+		pageSize:       paging.DefaultPageSize,
+		requestTimeout: defaultRequestTimeout,
+		nodePortRange:  DefaultNodePortRange,
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	return o
+}
+
+// withRequestTimeout derives the context of work the controller starts on its own from ctx.
+func (o *controllerOptions) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.requestTimeout)
+}
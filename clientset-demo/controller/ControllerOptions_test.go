@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"common/paging"
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+func TestNewControllerOptions(t *testing.T) {
+	backoff := wait.Backoff{Steps: 1}
+	tests := []struct {
+		name    string
+		options []Option
+		want    controllerOptions
+	}{
+		{name: "defaults", want: controllerOptions{backoff: retry.DefaultRetry, pageSize: paging.DefaultPageSize, requestTimeout: defaultRequestTimeout, nodePortRange: DefaultNodePortRange}},
+		{name: "set", options: []Option{WithBackoff(backoff), WithPageSize(10), WithRequestTimeout(time.Minute)},
+			want: controllerOptions{backoff: backoff, pageSize: 10, requestTimeout: time.Minute, nodePortRange: DefaultNodePortRange}},
+		{name: "last one wins", options: []Option{WithPageSize(10), WithPageSize(20)},
+			want: controllerOptions{backoff: retry.DefaultRetry, pageSize: 20, requestTimeout: defaultRequestTimeout, nodePortRange: DefaultNodePortRange}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := newControllerOptions(test.options); got != test.want {
+				t.Errorf("newControllerOptions() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      []Option
+		wantDeadline time.Duration
+	}{
+		{name: "default", wantDeadline: defaultRequestTimeout},
+		{name: "set", options: []Option{WithRequestTimeout(time.Minute)}, wantDeadline: time.Minute},
+		{name: "unbounded", options: []Option{WithRequestTimeout(0)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := newControllerOptions(test.options)
+			parent, cancelParent := context.WithCancel(context.Background())
+
+			ctx, cancel := options.withRequestTimeout(context.WithoutCancel(parent))
+			defer cancel()
+			cancelParent()
+			deadline, ok := ctx.Deadline()
+			if ok != (test.wantDeadline > 0) || (ok && time.Until(deadline) > test.wantDeadline) {
+				t.Errorf("withRequestTimeout() deadline = %v (%t), want in %v", deadline, ok, test.wantDeadline)
+			}
+			if ctx.Err() != nil {
+				t.Errorf("withRequestTimeout() canceled with the parent, want only the timeout")
+			}
+		})
+	}
+}
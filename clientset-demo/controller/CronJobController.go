@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"log"
+)
+
+// instantiateAnnotation marks the jobs created from a cronjob by hand, like "kubectl create job --from=cronjob/NAME".
+const instantiateAnnotation = "cronjob.kubernetes.io/instantiate"
+
+type CronJobController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+}
+
+func NewCronJobController(clientset kubernetes.Interface, options ...Option) *CronJobController {
+	return &CronJobController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+func NewCronJob(namespace, name string, options *CronJobOptions) *batchv1.CronJob {
+	suspend := options.Suspend
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    options.Job.Labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   options.Schedule,
+			TimeZone:                   options.TimeZone,
+			ConcurrencyPolicy:          options.ConcurrencyPolicy,
+			Suspend:                    &suspend,
+			SuccessfulJobsHistoryLimit: options.SuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     options.FailedJobsHistoryLimit,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: options.Job.Labels},
+				Spec:       options.Job.jobSpec(name),
+			},
+		},
+	}
+}
+
+func (receiver *CronJobController) CreateCronJob(ctx context.Context, namespace, name string, options *CronJobOptions) (*batchv1.CronJob, error) {
+	log.Printf("Creating cronjob: namespace: %s, name: %s\n", namespace, name)
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cronjob %s/%s: %w", namespace, name, err)
+	}
+	cronJob, err := receiver.clientset.BatchV1().CronJobs(namespace).Create(ctx, NewCronJob(namespace, name, options), metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create cronjob %s/%s", namespace, name)
+	}
+
+	return cronJob, nil
+}
+
+func (receiver *CronJobController) GetCronJob(ctx context.Context, namespace, name string) (*batchv1.CronJob, error) {
+	cronJob, err := receiver.clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get cronjob %s/%s", namespace, name)
+	}
+
+	return cronJob, nil
+}
+
+func (receiver *CronJobController) ListCronJobs(ctx context.Context, namespace string) (*batchv1.CronJobList, error) {
+	list, err := paging.List(ctx, receiver.clientset.BatchV1().CronJobs(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list cronjobs in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// UpdateCronJob changes the schedule or the job template of a cronjob with mutate. Jobs already started
+// keep their spec; SuspendCronJob pauses the schedule instead.
+func (receiver *CronJobController) UpdateCronJob(ctx context.Context, namespace, name string, mutate MutateFunc[*batchv1.CronJob]) (*batchv1.CronJob, error) {
+	log.Printf("Updating cronjob: namespace: %s, name: %s\n", namespace, name)
+	cronJob, err := updateNamed(ctx, receiver.backoff, receiver.clientset.BatchV1().CronJobs(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update cronjob %s/%s", namespace, name)
+	}
+
+	return cronJob, nil
+}
+
+// SuspendCronJob stops or resumes the scheduling of new jobs, running jobs are not affected.
+func (receiver *CronJobController) SuspendCronJob(ctx context.Context, namespace, name string, suspend bool) (*batchv1.CronJob, error) {
+	return receiver.UpdateCronJob(ctx, namespace, name, func(cronJob *batchv1.CronJob) error {
+		cronJob.Spec.Suspend = &suspend
+		return nil
+	})
+}
+
+// DeleteCronJob deletes the cronjob together with the jobs it created and their pods.
+func (receiver *CronJobController) DeleteCronJob(ctx context.Context, namespace, name string) error {
+	log.Printf("Deleting cronjob: namespace: %s, name: %s\n", namespace, name)
+	deletePolicy := metav1.DeletePropagationForeground
+	err := receiver.clientset.BatchV1().CronJobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &deletePolicy})
+	if err != nil {
+		return errs.Wrapf(err, "delete cronjob %s/%s", namespace, name)
+	}
+
+	return nil
+}
+
+// TriggerCronJob runs the cronjob once now, regardless of its schedule and suspension, like
+// "kubectl create job --from=cronjob/NAME". The job is owned by the cronjob, so it counts towards
+// its history limits and is deleted with it. Use JobController.WaitForJob to follow it.
+func (receiver *CronJobController) TriggerCronJob(ctx context.Context, namespace, name string) (*batchv1.Job, error) {
+	cronJob, err := receiver.GetCronJob(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]string{instantiateAnnotation: "manual"}
+	for key, value := range cronJob.Spec.JobTemplate.Annotations {
+		annotations[key] = value
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       namespace,
+			Name:            manualJobName(name),
+			Labels:          cronJob.Spec.JobTemplate.Labels,
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(cronJob, batchv1.SchemeGroupVersion.WithKind("CronJob"))},
+		},
+		Spec: cronJob.Spec.JobTemplate.Spec,
+	}
+	log.Printf("Triggering cronjob %s/%s as job %s\n", namespace, name, job.Name)
+	job, err = receiver.clientset.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "trigger cronjob %s/%s", namespace, name)
+	}
+
+	return job, nil
+}
+
+// manualJobName is "<cronjob>-manual-<random>", shortened to stay a valid job name.
+func manualJobName(cronJobName string) string {
+	suffix := "-manual-" + utilrand.String(5)
+	if len(cronJobName)+len(suffix) > validation.LabelValueMaxLength {
+		cronJobName = cronJobName[:validation.LabelValueMaxLength-len(suffix)]
+	}
+	return cronJobName + suffix
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTriggerCronJob(t *testing.T) {
+	options := &CronJobOptions{Schedule: "*/5 * * * *", Suspend: true, Job: JobOptions{DeploymentOptions: *NginxDeploymentOptions()}}
+	options.Job.Replicas = nil
+	cronJob := NewCronJob("demo", "backup", options)
+	cronJob.UID = "cronjob-uid"
+	cronJob.Spec.JobTemplate.Annotations = map[string]string{"team": "storage"}
+	clientset := fake.NewClientset(cronJob)
+
+	job, err := NewCronJobController(clientset).TriggerCronJob(context.Background(), "demo", "backup")
+	if err != nil {
+		t.Fatalf("TriggerCronJob() error = %v", err)
+	}
+	if !strings.HasPrefix(job.Name, "backup-manual-") {
+		t.Errorf("job name = %s, want backup-manual-<random>", job.Name)
+	}
+	if job.Annotations[instantiateAnnotation] != "manual" || job.Annotations["team"] != "storage" {
+		t.Errorf("annotations = %v, want the manual instantiation and the template's", job.Annotations)
+	}
+	owner := metav1.GetControllerOf(job)
+	if owner == nil || owner.Kind != "CronJob" || owner.Name != "backup" || owner.UID != cronJob.UID {
+		t.Errorf("controller = %+v, want the cronjob", owner)
+	}
+	if _, err := clientset.BatchV1().Jobs("demo").Get(context.Background(), job.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("job not stored: %v", err)
+	}
+}
+
+func TestTriggerCronJobNotFound(t *testing.T) {
+	_, err := NewCronJobController(fake.NewClientset()).TriggerCronJob(context.Background(), "demo", "missing")
+	if !errors.Is(err, errs.NotFound) {
+		t.Fatalf("TriggerCronJob() error = %v, want NotFound", err)
+	}
+}
+
+func TestManualJobName(t *testing.T) {
+	tests := []struct {
+		name        string
+		cronJobName string
+		wantPrefix  string
+	}{
+		{name: "short name is kept", cronJobName: "backup", wantPrefix: "backup-manual-"},
+		{name: "long name is shortened", cronJobName: strings.Repeat("a", validation.LabelValueMaxLength), wantPrefix: strings.Repeat("a", 50) + "-manual-"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := manualJobName(test.cronJobName)
+			if !strings.HasPrefix(name, test.wantPrefix) {
+				t.Errorf("manualJobName() = %s, want prefix %s", name, test.wantPrefix)
+			}
+			if len(name) > validation.LabelValueMaxLength {
+				t.Errorf("manualJobName() is %d characters, want at most %d", len(name), validation.LabelValueMaxLength)
+			}
+			if err := validateJobName(name); err != nil {
+				t.Errorf("manualJobName() is not a valid job name: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"log"
+)
+
+type DaemonSetController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+}
+
+func NewDaemonSetController(clientset kubernetes.Interface, options ...Option) *DaemonSetController {
+	return &DaemonSetController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+// NewDaemonSet runs one pod described by options on every node matching options.NodeSelector, Replicas is ignored.
+func NewDaemonSet(namespace, name string, options *DeploymentOptions) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    options.Labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: options.selector(),
+			},
+			Template: options.podTemplate(name),
+		},
+	}
+}
+
+func (receiver *DaemonSetController) CreateDaemonSet(ctx context.Context, namespace, name string, options *DeploymentOptions) (*appsv1.DaemonSet, error) {
+	log.Printf("Creating daemonset: namespace: %s, name: %s\n", namespace, name)
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid daemonset %s/%s: %w", namespace, name, err)
+	}
+	daemonSet, err := receiver.clientset.AppsV1().DaemonSets(namespace).Create(ctx, NewDaemonSet(namespace, name, options), metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create daemonset %s/%s", namespace, name)
+	}
+
+	return daemonSet, nil
+}
+
+func (receiver *DaemonSetController) GetDaemonSet(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+	daemonSet, err := receiver.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get daemonset %s/%s", namespace, name)
+	}
+
+	return daemonSet, nil
+}
+
+func (receiver *DaemonSetController) ListDaemonSets(ctx context.Context, namespace string) (*appsv1.DaemonSetList, error) {
+	list, err := paging.List(ctx, receiver.clientset.AppsV1().DaemonSets(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list daemonsets in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// UpdateDaemonSet edits a daemonset with mutate. A changed pod template is rolled out node by node,
+// following spec.updateStrategy.
+func (receiver *DaemonSetController) UpdateDaemonSet(ctx context.Context, namespace, name string, mutate MutateFunc[*appsv1.DaemonSet]) (*appsv1.DaemonSet, error) {
+	log.Printf("Updating daemonset: namespace: %s, name: %s\n", namespace, name)
+	daemonSet, err := updateNamed(ctx, receiver.backoff, receiver.clientset.AppsV1().DaemonSets(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update daemonset %s/%s", namespace, name)
+	}
+
+	return daemonSet, nil
+}
+
+func (receiver *DaemonSetController) DeleteDaemonSet(ctx context.Context, namespace, name string) error {
+	log.Printf("Deleting daemonset: namespace: %s, name: %s\n", namespace, name)
+	deletePolicy := metav1.DeletePropagationForeground
+	err := receiver.clientset.AppsV1().DaemonSets(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &deletePolicy})
+	if err != nil {
+		return errs.Wrapf(err, "delete daemonset %s/%s", namespace, name)
+	}
+
+	return nil
+}
@@ -1,78 +1,82 @@
 package controller
 
 import (
-	"clientset-demo/constant"
-	"clientset-demo/util"
+	"clientset-demo/errs"
+	"common/paging"
 	"context"
 	"fmt"
+	"iter"
 	appsv1 "k8s.io/api/apps/v1"
-	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/retry"
 	"log"
 )
 
 type DeploymentController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+	cache     *Cache // serves the reads when set, see WithCache.
 }
 
-func NewDeployment(namespace, name string) *appsv1.Deployment {
+func NewDeploymentController(clientset kubernetes.Interface, options ...Option) *DeploymentController {
+	return &DeploymentController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+// WithCache serves ListDeployments from c instead of the API server. c must be started and synced.
+func (receiver *DeploymentController) WithCache(c *Cache) *DeploymentController {
+	receiver.cache = c
+	return receiver
+}
+
+func NewDeployment(namespace, name string, options *DeploymentOptions) *appsv1.Deployment {
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: namespace,
 			Name:      name,
+			Labels:    options.Labels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: util.Int32Ptr(3),
+			Replicas: options.Replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "nginx-demo",
-				},
-			},
-			Template: apiv1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: name,
-					Labels: map[string]string{
-						"app": "nginx-demo",
-					},
-				},
-				Spec: apiv1.PodSpec{
-					Containers: []apiv1.Container{
-						{
-							Name:  "web",
-							Image: "harbor.dev.com/test-demo/nginx:1.12",
-							Ports: []apiv1.ContainerPort{
-								{
-									Name:          "http",
-									Protocol:      apiv1.ProtocolTCP,
-									ContainerPort: 80,
-								},
-							},
-							ImagePullPolicy: apiv1.PullIfNotPresent,
-						},
-					},
-					RestartPolicy: apiv1.RestartPolicyAlways,
-				},
+				MatchLabels: options.selector(),
 			},
+			Template: options.podTemplate(name),
 		},
 	}
 
 	return deployment
 }
 
-func (receiver *DeploymentController) CreateDeployment(clientset *kubernetes.Clientset, namespace, name string) (*appsv1.Deployment, error) {
+func (receiver *DeploymentController) CreateDeployment(ctx context.Context, namespace, name string, options *DeploymentOptions) (*appsv1.Deployment, error) {
 	// Create Deployment
 	log.Println("creating deployment...")
-	deploymentsClient := clientset.AppsV1().Deployments(namespace)
-	deployment := NewDeployment(constant.NginxNamespace, name)
-	result, err := deploymentsClient.Create(context.TODO(), deployment, metav1.CreateOptions{})
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid deployment %s/%s: %w", namespace, name, err)
+	}
+	deploymentsClient := receiver.clientset.AppsV1().Deployments(namespace)
+	deployment := NewDeployment(namespace, name, options)
+	if len(options.ConfigMaps) > 0 || len(options.Secrets) > 0 {
+		configHash, err := fetchConfigHash(ctx, receiver.clientset, namespace, options.ConfigMaps, options.Secrets, false)
+		if err != nil {
+			return nil, err
+		}
+		stampConfigHash(&deployment.Spec.Template, configHash)
+	}
+	result, err := deploymentsClient.Create(ctx, deployment, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create deployment %s/%s", namespace, name)
+	}
 
-	return result, err
+	return result, nil
 }
 
-func (receiver *DeploymentController) UpdateDeployments(clientset *kubernetes.Clientset, namespace, name string) error {
+// UpdateDeployment edits a deployment with mutate. A changed pod template starts a new rollout,
+// see WaitForRollout, while a change of replicas only scales the current one.
+func (receiver *DeploymentController) UpdateDeployment(ctx context.Context, namespace, name string, mutate MutateFunc[*appsv1.Deployment]) (*appsv1.Deployment, error) {
 	log.Println("Updating deployment...")
-	deploymentsClient := clientset.AppsV1().Deployments(namespace)
 	//    You have two options to Update() this Deployment:
 	//
 	//    1. Modify the "deployment" variable and call: Update(deployment).
@@ -80,46 +84,123 @@ func (receiver *DeploymentController) UpdateDeployments(clientset *kubernetes.Cl
 	//       made by other clients between you Create() and Update() the object.
 	//    2. Modify the "result" returned by Get() and retry Update(result) until
 	//       you no longer get a conflict error. This way, you can preserve changes made
-	//       by other clients between Create() and Update(). This is implemented below
-	//			 using the retry utility package included with client-go. (RECOMMENDED)
-	//
-	// More Info:
-	// https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#concurrency-control-and-consistency
-	retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		result, getErr := deploymentsClient.Get(context.TODO(), name, metav1.GetOptions{})
-		if getErr != nil {
-			panic(fmt.Errorf("failed to get the latest version of Deployment(nginx-demo): %v", getErr))
-		}
-		result.Spec.Replicas = util.Int32Ptr(1)                                               // reduce replica count
-		result.Spec.Template.Spec.Containers[0].Image = "harbor.dev.com/test-demo/nginx:1.13" // change nginx version
-		_, updateErr := deploymentsClient.Update(context.TODO(), result, metav1.UpdateOptions{})
-
-		return updateErr
-	})
-	if retryErr != nil {
-		return retryErr
+	//       by other clients between Create() and Update(). This is implemented by
+	//			 updateWithRetry using the retry utility package included with client-go. (RECOMMENDED)
+	result, err := updateNamed(ctx, receiver.backoff, receiver.clientset.AppsV1().Deployments(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update deployment %s/%s", namespace, name)
 	}
 
 	log.Println("updated deployment...")
-	return nil
+	return result, nil
+}
+
+// PatchDeployment sends a patch of type pt, one of types.JSONPatchType, types.MergePatchType or
+// types.StrategicMergePatchType. See NewJSONPatch and CreateStrategicMergePatch to build data.
+func (receiver *DeploymentController) PatchDeployment(ctx context.Context, namespace, name string, pt types.PatchType, data []byte) (*appsv1.Deployment, error) {
+	log.Printf("Patching deployment: namespace: %s, name: %s, type: %s\n", namespace, name, pt)
+	result, err := receiver.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, pt, data, metav1.PatchOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "patch deployment %s/%s", namespace, name)
+	}
+
+	return result, nil
+}
+
+// ApplyDeployment server-side applies the fields set in deployment on behalf of fieldManager.
+// force takes over fields owned by other managers instead of failing with a conflict.
+func (receiver *DeploymentController) ApplyDeployment(ctx context.Context, deployment *appsv1.Deployment, fieldManager string, force bool) (*appsv1.Deployment, error) {
+	log.Printf("Applying deployment: namespace: %s, name: %s\n", deployment.Namespace, deployment.Name)
+	data, err := applyConfiguration(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+	if err != nil {
+		return nil, err
+	}
+	result, err := receiver.clientset.AppsV1().Deployments(deployment.Namespace).Patch(ctx, deployment.Name, types.ApplyPatchType, data,
+		metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
+	if err != nil {
+		return nil, errs.Wrapf(err, "apply deployment %s/%s", deployment.Namespace, deployment.Name)
+	}
+
+	return result, nil
 }
 
-func (receiver *DeploymentController) ListDeployments(clientset *kubernetes.Clientset, namespace string) (*appsv1.DeploymentList, error) {
+func (receiver *DeploymentController) ListDeployments(ctx context.Context, namespace string) (*appsv1.DeploymentList, error) {
 	log.Printf("Listing deployments in namespace %q:\n", namespace)
+	if receiver.cache != nil {
+		var deployments []*appsv1.Deployment
+		var err error
+		if namespace == metav1.NamespaceAll {
+			deployments, err = receiver.cache.DeploymentLister().List(labels.Everything())
+		} else {
+			deployments, err = receiver.cache.DeploymentLister().Deployments(namespace).List(labels.Everything())
+		}
+		if err != nil {
+			return nil, errs.Wrapf(err, "list cached deployments in %s", namespace)
+		}
+		list := &appsv1.DeploymentList{Items: make([]appsv1.Deployment, 0, len(deployments))}
+		for _, deployment := range deployments {
+			list.Items = append(list.Items, *deployment.DeepCopy())
+		}
+		return list, nil
+	}
+
+	list, err := paging.List(ctx, receiver.clientset.AppsV1().Deployments(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list deployments in %s", namespace)
+	}
 
-	deploymentsClient := clientset.AppsV1().Deployments(namespace)
-	list, err := deploymentsClient.List(context.TODO(), metav1.ListOptions{})
+	return list, nil
+}
 
-	return list, err
+// Deployments iterates over the deployments of namespace a page at a time, without loading them all:
+//
+//	for deployment, err := range deploymentController.Deployments(ctx, namespace) {
+//		...
+//	}
+//
+// With a cache the deployments are the cached ones, they are shared and must not be modified.
+func (receiver *DeploymentController) Deployments(ctx context.Context, namespace string) iter.Seq2[*appsv1.Deployment, error] {
+	if receiver.cache != nil {
+		return func(yield func(*appsv1.Deployment, error) bool) {
+			list, err := receiver.cache.DeploymentLister().Deployments(namespace).List(labels.Everything())
+			if err != nil {
+				yield(nil, errs.Wrapf(err, "list cached deployments in %s", namespace))
+				return
+			}
+			for _, deployment := range list {
+				if !yield(deployment, nil) {
+					return
+				}
+			}
+		}
+	}
+
+	return func(yield func(*appsv1.Deployment, error) bool) {
+		for deployment, err := range paging.Items[*appsv1.Deployment](ctx, receiver.listFunc(namespace), metav1.ListOptions{}, receiver.pageSize) {
+			if err != nil {
+				yield(nil, errs.Wrapf(err, "list deployments in %s", namespace))
+				return
+			}
+			if !yield(deployment, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (receiver *DeploymentController) listFunc(namespace string) paging.ListFunc {
+	return func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return receiver.clientset.AppsV1().Deployments(namespace).List(ctx, options)
+	}
 }
 
-func (receiver *DeploymentController) DeleteDeployments(clientset *kubernetes.Clientset, namespace, name string) error {
+func (receiver *DeploymentController) DeleteDeployments(ctx context.Context, namespace, name string) error {
 	log.Println("Deleting deployments...")
 
-	deploymentsClient := clientset.AppsV1().Deployments(namespace)
+	deploymentsClient := receiver.clientset.AppsV1().Deployments(namespace)
 	deletePolicy := metav1.DeletePropagationForeground // 'Foreground' - 删除前台中所有依赖项的级联策略。
-	if err := deploymentsClient.Delete(context.TODO(), name, metav1.DeleteOptions{PropagationPolicy: &deletePolicy}); err != nil {
-		return err
+	if err := deploymentsClient.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &deletePolicy}); err != nil {
+		return errs.Wrapf(err, "delete deployment %s/%s", namespace, name)
 	}
 
 	log.Println("Deleted deployment.")
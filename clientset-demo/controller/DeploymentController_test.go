@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"clientset-demo/util"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// countActions counts the requests of verb on resource the fake clientset received.
+func countActions(clientset *fake.Clientset, verb, resource string) int {
+	count := 0
+	for _, action := range clientset.Actions() {
+		if action.Matches(verb, resource) && action.GetSubresource() == "" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCreateDeployment(t *testing.T) {
+	tests := []struct {
+		name    string
+		options func(*DeploymentOptions)
+		wantErr bool
+	}{
+		{name: "nginx demo", options: func(*DeploymentOptions) {}},
+		{name: "replicas left to the server", options: func(o *DeploymentOptions) { o.Replicas = nil }},
+		{name: "negative replicas", options: func(o *DeploymentOptions) { o.Replicas = util.Int32Ptr(-1) }, wantErr: true},
+		{name: "no container", options: func(o *DeploymentOptions) { o.Containers = nil }, wantErr: true},
+		{name: "selector conflicting with labels", options: func(o *DeploymentOptions) { o.Selector = map[string]string{"app": "other"} }, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset()
+			options := NginxDeploymentOptions()
+			test.options(options)
+
+			deployment, err := NewDeploymentController(clientset).CreateDeployment(context.Background(), "demo", "nginx-demo", options)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("CreateDeployment() succeeded, want an error")
+				}
+				if creates := countActions(clientset, "create", "deployments"); creates != 0 {
+					t.Errorf("invalid options sent %d creates", creates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateDeployment() error = %v", err)
+			}
+			if !reflect.DeepEqual(deployment.Spec.Replicas, options.Replicas) {
+				t.Errorf("replicas = %v, want %v", deployment.Spec.Replicas, options.Replicas)
+			}
+			if deployment.Spec.Selector.MatchLabels["app"] != "nginx-demo" {
+				t.Errorf("selector = %v, want the labels", deployment.Spec.Selector.MatchLabels)
+			}
+			stored, err := clientset.AppsV1().Deployments("demo").Get(context.Background(), "nginx-demo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("deployment not stored: %v", err)
+			}
+			if image := stored.Spec.Template.Spec.Containers[0].Image; image != options.Containers[0].Image {
+				t.Errorf("image = %s, want %s", image, options.Containers[0].Image)
+			}
+		})
+	}
+}
+
+func TestCreateDeploymentAlreadyExists(t *testing.T) {
+	clientset := fake.NewClientset(NewDeployment("demo", "nginx-demo", NginxDeploymentOptions()))
+
+	_, err := NewDeploymentController(clientset).CreateDeployment(context.Background(), "demo", "nginx-demo", NginxDeploymentOptions())
+	if !errors.Is(err, errs.AlreadyExists) {
+		t.Fatalf("CreateDeployment() error = %v, want AlreadyExists", err)
+	}
+}
+
+func TestUpdateDeployment(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      MutateFunc[*appsv1.Deployment]
+		wantUpdates int
+		wantErr     error
+	}{
+		{
+			name: "changes are stored",
+			mutate: func(deployment *appsv1.Deployment) error {
+				replicas := int32(1)
+				deployment.Spec.Replicas = &replicas
+				deployment.Spec.Template.Spec.Containers[0].Image = "nginx:1.27"
+				return nil
+			},
+			wantUpdates: 1,
+		},
+		{
+			name:        "unchanged deployment is not written",
+			mutate:      func(*appsv1.Deployment) error { return nil },
+			wantUpdates: 0,
+		},
+		{
+			name:        "mutate error aborts",
+			mutate:      func(*appsv1.Deployment) error { return errs.Conflict },
+			wantUpdates: 0,
+			wantErr:     errs.Conflict,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset(NewDeployment("demo", "nginx-demo", NginxDeploymentOptions()))
+
+			_, err := NewDeploymentController(clientset).UpdateDeployment(context.Background(), "demo", "nginx-demo", test.mutate)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("UpdateDeployment() error = %v, want %v", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("UpdateDeployment() error = %v", err)
+			}
+			if updates := countActions(clientset, "update", "deployments"); updates != test.wantUpdates {
+				t.Errorf("UpdateDeployment() sent %d updates, want %d", updates, test.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestUpdateDeploymentNotFound(t *testing.T) {
+	_, err := NewDeploymentController(fake.NewClientset()).UpdateDeployment(context.Background(), "demo", "missing",
+		func(*appsv1.Deployment) error { return nil })
+	if !errors.Is(err, errs.NotFound) {
+		t.Fatalf("UpdateDeployment() error = %v, want NotFound", err)
+	}
+}
+
+func TestListDeployments(t *testing.T) {
+	clientset := fake.NewClientset(
+		NewDeployment("demo", "a", NginxDeploymentOptions()),
+		NewDeployment("demo", "b", NginxDeploymentOptions()),
+		NewDeployment("other", "c", NginxDeploymentOptions()),
+	)
+	controller := NewDeploymentController(clientset, WithPageSize(1))
+
+	list, err := controller.ListDeployments(context.Background(), "demo")
+	if err != nil {
+		t.Fatalf("ListDeployments() error = %v", err)
+	}
+	if len(list.Items) != 2 {
+		t.Errorf("ListDeployments() returned %d deployments, want 2", len(list.Items))
+	}
+
+	count := 0
+	for _, err := range controller.Deployments(context.Background(), metav1.NamespaceAll) {
+		if err != nil {
+			t.Fatalf("Deployments() error = %v", err)
+		}
+		count++
+	}
+	if count != 3 {
+		t.Errorf("Deployments() yielded %d deployments, want 3", count)
+	}
+}
+
+func TestDeleteDeployments(t *testing.T) {
+	clientset := fake.NewClientset(NewDeployment("demo", "nginx-demo", NginxDeploymentOptions()))
+	controller := NewDeploymentController(clientset)
+
+	if err := controller.DeleteDeployments(context.Background(), "demo", "nginx-demo"); err != nil {
+		t.Fatalf("DeleteDeployments() error = %v", err)
+	}
+	for _, action := range clientset.Actions() {
+		if deleteAction, ok := action.(k8stesting.DeleteActionImpl); ok {
+			if policy := deleteAction.DeleteOptions.PropagationPolicy; policy == nil || *policy != metav1.DeletePropagationForeground {
+				t.Errorf("delete propagation = %v, want Foreground", policy)
+			}
+		}
+	}
+	if err := controller.DeleteDeployments(context.Background(), "demo", "nginx-demo"); !errors.Is(err, errs.NotFound) {
+		t.Fatalf("second DeleteDeployments() error = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"clientset-demo/constant"
+	"clientset-demo/util"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sort"
+)
+
+// ContainerOptions describes one container of the deployment's pod template.
+type ContainerOptions struct {
+	Name            string // defaults to the deployment name for a single container.
+	Image           string
+	ImagePullPolicy apiv1.PullPolicy // defaults to IfNotPresent.
+	Command         []string
+	Args            []string
+	Ports           []apiv1.ContainerPort
+	Env             []apiv1.EnvVar
+	Resources       apiv1.ResourceRequirements
+	LivenessProbe   *apiv1.Probe
+	ReadinessProbe  *apiv1.Probe
+	VolumeMounts    []apiv1.VolumeMount
+}
+
+// DeploymentOptions describes the deployment built by NewDeployment.
+type DeploymentOptions struct {
+	Replicas     *int32            // nil leaves the API server's default of 1.
+	Labels       map[string]string // labels of the deployment and its pods.
+	Selector     map[string]string // pod selector, defaults to Labels.
+	Containers   []ContainerOptions
+	Volumes      []apiv1.Volume
+	NodeSelector map[string]string
+	// ConfigMaps and Secrets name the configmaps and secrets of the namespace the pods depend on.
+	// CreateDeployment stamps their ConfigHash on the pod template, so that StampConfigHash only
+	// rolls the pods once they change.
+	ConfigMaps []string
+	Secrets    []string
+}
+
+// NginxDeploymentOptions returns the options of the nginx demo deployment.
+func NginxDeploymentOptions() *DeploymentOptions {
+	return &DeploymentOptions{
+		Replicas: util.Int32Ptr(3),
+		Labels: map[string]string{
+			"app": "nginx-demo",
+		},
+		Containers: []ContainerOptions{
+			{
+				Name:  "web",
+				Image: constant.NginxImage,
+				Ports: []apiv1.ContainerPort{
+					{
+						Name:          "http",
+						Protocol:      apiv1.ProtocolTCP,
+						ContainerPort: 80,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Validate checks that the options describe a deployment the API server accepts.
+func (o *DeploymentOptions) Validate() error {
+	if o.Replicas != nil && *o.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative, got %d", *o.Replicas)
+	}
+	if err := o.validateContainers(); err != nil {
+		return err
+	}
+	if len(o.selector()) == 0 {
+		return fmt.Errorf("a selector or labels are required")
+	}
+	for key, value := range o.Selector {
+		if label, ok := o.Labels[key]; ok && label != value {
+			return fmt.Errorf("selector %s=%s conflicts with label %s=%s", key, value, key, label)
+		}
+	}
+
+	return nil
+}
+
+func (o *DeploymentOptions) validateContainers() error {
+	if len(o.Containers) == 0 {
+		return fmt.Errorf("at least one container is required")
+	}
+	for i, container := range o.Containers {
+		if container.Image == "" {
+			return fmt.Errorf("containers[%d]: image is required", i)
+		}
+		if container.Name == "" && len(o.Containers) > 1 {
+			return fmt.Errorf("containers[%d]: name is required with multiple containers", i)
+		}
+	}
+	return nil
+}
+
+func (o *DeploymentOptions) selector() map[string]string {
+	if len(o.Selector) > 0 {
+		return o.Selector
+	}
+	return o.Labels
+}
+
+// podLabels are the labels plus the selector, so that the selector always matches the pods.
+func (o *DeploymentOptions) podLabels() map[string]string {
+	labels := make(map[string]string, len(o.Labels))
+	for key, value := range o.Labels {
+		labels[key] = value
+	}
+	for key, value := range o.selector() {
+		labels[key] = value
+	}
+	return labels
+}
+
+// podTemplate is the pod template of the workload name, its containers default to that name.
+func (o *DeploymentOptions) podTemplate(name string) apiv1.PodTemplateSpec {
+	containers := make([]apiv1.Container, 0, len(o.Containers))
+	for _, container := range o.Containers {
+		containers = append(containers, container.container(name))
+	}
+
+	return apiv1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: o.podLabels(),
+		},
+		Spec: apiv1.PodSpec{
+			Containers:    containers,
+			Volumes:       o.Volumes,
+			NodeSelector:  o.NodeSelector,
+			RestartPolicy: apiv1.RestartPolicyAlways,
+		},
+	}
+}
+
+func (o *ContainerOptions) container(defaultName string) apiv1.Container {
+	container := apiv1.Container{
+		Name:            o.Name,
+		Image:           o.Image,
+		ImagePullPolicy: o.ImagePullPolicy,
+		Command:         o.Command,
+		Args:            o.Args,
+		Ports:           o.Ports,
+		Env:             o.Env,
+		Resources:       o.Resources,
+		LivenessProbe:   o.LivenessProbe,
+		ReadinessProbe:  o.ReadinessProbe,
+		VolumeMounts:    o.VolumeMounts,
+	}
+	if container.Name == "" {
+		container.Name = defaultName
+	}
+	if container.ImagePullPolicy == "" {
+		container.ImagePullPolicy = apiv1.PullIfNotPresent
+	}
+	return container
+}
+
+// EnvVars turns a map into env vars, sorted by name so that the pod template is stable.
+func EnvVars(env map[string]string) []apiv1.EnvVar {
+	vars := make([]apiv1.EnvVar, 0, len(env))
+	for name, value := range env {
+		vars = append(vars, apiv1.EnvVar{Name: name, Value: value})
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	return vars
+}
+
+// Resources parses quantities such as "100m" or "128Mi" into requests and limits; empty values are skipped.
+func Resources(requestCPU, requestMemory, limitCPU, limitMemory string) (apiv1.ResourceRequirements, error) {
+	var requirements apiv1.ResourceRequirements
+	for _, item := range []struct {
+		list     *apiv1.ResourceList
+		resource apiv1.ResourceName
+		value    string
+	}{
+		{&requirements.Requests, apiv1.ResourceCPU, requestCPU},
+		{&requirements.Requests, apiv1.ResourceMemory, requestMemory},
+		{&requirements.Limits, apiv1.ResourceCPU, limitCPU},
+		{&requirements.Limits, apiv1.ResourceMemory, limitMemory},
+	} {
+		if item.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(item.value)
+		if err != nil {
+			return requirements, fmt.Errorf("invalid %s quantity %q: %w", item.resource, item.value, err)
+		}
+		if *item.list == nil {
+			*item.list = apiv1.ResourceList{}
+		}
+		(*item.list)[item.resource] = quantity
+	}
+
+	return requirements, nil
+}
+
+// HTTPGetProbe probes path on port every periodSeconds.
+func HTTPGetProbe(path string, port int32, periodSeconds int32) *apiv1.Probe {
+	return &apiv1.Probe{
+		ProbeHandler: apiv1.ProbeHandler{
+			HTTPGet: &apiv1.HTTPGetAction{
+				Path: path,
+				Port: intstr.FromInt32(port),
+			},
+		},
+		PeriodSeconds: periodSeconds,
+	}
+}
@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"log"
+	"sort"
+	"strconv"
+)
+
+const (
+	// progressDeadlineExceeded is the reason of the Progressing condition once progressDeadlineSeconds is exceeded.
+	progressDeadlineExceeded = "ProgressDeadlineExceeded"
+	// revisionAnnotation holds the revision of a deployment and of its ReplicaSets.
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+	// changeCauseAnnotation is the free-form reason of a change, shown by the history.
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+)
+
+// RolloutRevision is one entry of the rollout history of a deployment.
+type RolloutRevision struct {
+	Revision    int64
+	ReplicaSet  string
+	ChangeCause string
+	Template    apiv1.PodTemplateSpec // without the pod-template-hash label.
+	// Diff is the strategic merge patch turning the template of the previous revision into this one,
+	// empty for the oldest revision.
+	Diff string
+}
+
+// WaitForRollout watches the deployment until its rollout completes, logging the progress like
+// "kubectl rollout status". It fails with errs.RolloutFailed when progressDeadlineSeconds is exceeded.
+func (receiver *DeploymentController) WaitForRollout(ctx context.Context, namespace, name string) error {
+	log.Printf("Waiting for deployment %q rollout to finish...\n", name)
+	deploymentsClient := receiver.clientset.AppsV1().Deployments(namespace)
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return deploymentsClient.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return deploymentsClient.Watch(ctx, options)
+		},
+	}
+
+	lastMessage := ""
+	_, err := watchtools.UntilWithSync(ctx, lw, &appsv1.Deployment{}, nil, func(event watch.Event) (bool, error) {
+		switch event.Type {
+		case watch.Deleted:
+			return false, fmt.Errorf("deployment %s/%s was deleted during the rollout", namespace, name)
+		case watch.Added, watch.Modified:
+			deployment, ok := event.Object.(*appsv1.Deployment)
+			if !ok {
+				return false, fmt.Errorf("unexpected object %T", event.Object)
+			}
+			message, done, err := RolloutStatus(deployment)
+			if err != nil {
+				return false, err
+			}
+			if message != lastMessage {
+				log.Println(message)
+				lastMessage = message
+			}
+			return done, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return errs.Wrapf(err, "wait for rollout of deployment %s/%s", namespace, name)
+	}
+
+	return nil
+}
+
+// RolloutStatus describes the rollout progress of deployment and reports whether it is complete,
+// following the same rules as kubectl's DeploymentStatusViewer.
+func RolloutStatus(deployment *appsv1.Deployment) (string, bool, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return "Waiting for deployment spec update to be observed...", false, nil
+	}
+
+	if condition := deploymentCondition(deployment.Status, appsv1.DeploymentProgressing); condition != nil && condition.Reason == progressDeadlineExceeded {
+		return "", false, &errs.Error{
+			Kind: errs.RolloutFailed,
+			Op:   fmt.Sprintf("rollout of deployment %q", deployment.Name),
+			Err:  fmt.Errorf("%s: %s", condition.Reason, condition.Message),
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	switch {
+	case status.UpdatedReplicas < replicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...", deployment.Name, status.UpdatedReplicas, replicas), false, nil
+	case status.Replicas > status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...", deployment.Name, status.Replicas-status.UpdatedReplicas), false, nil
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...", deployment.Name, status.AvailableReplicas, status.UpdatedReplicas), false, nil
+	}
+
+	return fmt.Sprintf("deployment %q successfully rolled out", deployment.Name), true, nil
+}
+
+func deploymentCondition(status appsv1.DeploymentStatus, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// RolloutHistory lists the revisions of the deployment, oldest first, like "kubectl rollout history".
+// Revisions are read from the ReplicaSets owned by the deployment.
+func (receiver *DeploymentController) RolloutHistory(ctx context.Context, namespace, name string) ([]RolloutRevision, error) {
+	deployment, err := receiver.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get deployment %s/%s", namespace, name)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list := func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return receiver.clientset.AppsV1().ReplicaSets(namespace).List(ctx, options)
+	}
+
+	var history []RolloutRevision
+	for replicaSet, err := range paging.Items[*appsv1.ReplicaSet](ctx, list, metav1.ListOptions{LabelSelector: selector.String()}, receiver.pageSize) {
+		if err != nil {
+			return nil, errs.Wrapf(err, "list replicasets of deployment %s/%s", namespace, name)
+		}
+		if !metav1.IsControlledBy(replicaSet, deployment) {
+			continue
+		}
+		revision, err := strconv.ParseInt(replicaSet.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue // not yet annotated by the deployment controller.
+		}
+		template := *replicaSet.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		history = append(history, RolloutRevision{
+			Revision:    revision,
+			ReplicaSet:  replicaSet.Name,
+			ChangeCause: replicaSet.Annotations[changeCauseAnnotation],
+			Template:    template,
+		})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Revision < history[j].Revision
+	})
+
+	for i := 1; i < len(history); i++ {
+		diff, err := templateDiff(history[i-1].Template, history[i].Template)
+		if err != nil {
+			return nil, err
+		}
+		history[i].Diff = diff
+	}
+
+	return history, nil
+}
+
+// RolloutUndo restores the pod template of toRevision, or of the previous revision when toRevision is 0,
+// like "kubectl rollout undo".
+func (receiver *DeploymentController) RolloutUndo(ctx context.Context, namespace, name string, toRevision int64) (*appsv1.Deployment, error) {
+	log.Printf("Rolling back deployment %s/%s...\n", namespace, name)
+	history, err := receiver.RolloutHistory(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	target, err := undoTarget(history, toRevision)
+	if err != nil {
+		return nil, fmt.Errorf("rollback deployment %s/%s: %w", namespace, name, err)
+	}
+
+	result, err := receiver.UpdateDeployment(ctx, namespace, name, func(deployment *appsv1.Deployment) error {
+		if deployment.Spec.Paused {
+			return fmt.Errorf("deployment is paused, resume it before rolling back")
+		}
+		deployment.Spec.Template = target.Template
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("rolled back deployment %s/%s to revision %d\n", namespace, name, target.Revision)
+	return result, nil
+}
+
+// undoTarget picks toRevision from history, or the one before the current (latest) revision.
+func undoTarget(history []RolloutRevision, toRevision int64) (*RolloutRevision, error) {
+	if toRevision == 0 {
+		if len(history) < 2 {
+			return nil, fmt.Errorf("no previous revision to roll back to")
+		}
+		return &history[len(history)-2], nil
+	}
+	for i := range history {
+		if history[i].Revision == toRevision {
+			return &history[i], nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d not found", toRevision)
+}
+
+// templateDiff returns the strategic merge patch from the original to the modified template.
+func templateDiff(original, modified apiv1.PodTemplateSpec) (string, error) {
+	patch, err := strategicMergePatch(original, modified, apiv1.PodTemplateSpec{})
+	if err != nil {
+		return "", err
+	}
+
+	return string(patch), nil
+}
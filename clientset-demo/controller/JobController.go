@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"log"
+)
+
+type JobController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+}
+
+func NewJobController(clientset kubernetes.Interface, options ...Option) *JobController {
+	return &JobController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+func NewJob(namespace, name string, options *JobOptions) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    options.Labels,
+		},
+		Spec: options.jobSpec(name),
+	}
+}
+
+func (receiver *JobController) CreateJob(ctx context.Context, namespace, name string, options *JobOptions) (*batchv1.Job, error) {
+	log.Printf("Creating job: namespace: %s, name: %s\n", namespace, name)
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid job %s/%s: %w", namespace, name, err)
+	}
+	if err := validateJobName(name); err != nil {
+		return nil, fmt.Errorf("invalid job %s/%s: %w", namespace, name, err)
+	}
+	job, err := receiver.clientset.BatchV1().Jobs(namespace).Create(ctx, NewJob(namespace, name, options), metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create job %s/%s", namespace, name)
+	}
+
+	return job, nil
+}
+
+func (receiver *JobController) GetJob(ctx context.Context, namespace, name string) (*batchv1.Job, error) {
+	job, err := receiver.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get job %s/%s", namespace, name)
+	}
+
+	return job, nil
+}
+
+func (receiver *JobController) ListJobs(ctx context.Context, namespace string) (*batchv1.JobList, error) {
+	list, err := paging.List(ctx, receiver.clientset.BatchV1().Jobs(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list jobs in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// UpdateJob edits a job with mutate. Most of the spec of a job is immutable, e.g. to suspend or resume it
+// set Spec.Suspend.
+func (receiver *JobController) UpdateJob(ctx context.Context, namespace, name string, mutate MutateFunc[*batchv1.Job]) (*batchv1.Job, error) {
+	log.Printf("Updating job: namespace: %s, name: %s\n", namespace, name)
+	job, err := updateNamed(ctx, receiver.backoff, receiver.clientset.BatchV1().Jobs(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update job %s/%s", namespace, name)
+	}
+
+	return job, nil
+}
+
+// DeleteJob deletes the job and its pods. Without a propagation policy the API server would orphan the pods.
+func (receiver *JobController) DeleteJob(ctx context.Context, namespace, name string) error {
+	log.Printf("Deleting job: namespace: %s, name: %s\n", namespace, name)
+	deletePolicy := metav1.DeletePropagationForeground
+	err := receiver.clientset.BatchV1().Jobs(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &deletePolicy})
+	if err != nil {
+		return errs.Wrapf(err, "delete job %s/%s", namespace, name)
+	}
+
+	return nil
+}
+
+// WaitForJob watches the job until it completes and returns it, like "kubectl wait --for=condition=complete".
+// It fails with errs.JobFailed when the job fails, e.g. after exceeding its backoff limit or deadline.
+func (receiver *JobController) WaitForJob(ctx context.Context, namespace, name string) (*batchv1.Job, error) {
+	log.Printf("Waiting for job %q to complete...\n", name)
+	jobsClient := receiver.clientset.BatchV1().Jobs(namespace)
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return jobsClient.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return jobsClient.Watch(ctx, options)
+		},
+	}
+
+	var job *batchv1.Job
+	_, err := watchtools.UntilWithSync(ctx, lw, &batchv1.Job{}, nil, func(event watch.Event) (bool, error) {
+		switch event.Type {
+		case watch.Deleted:
+			return false, fmt.Errorf("job %s/%s was deleted while waiting", namespace, name)
+		case watch.Added, watch.Modified:
+			var ok bool
+			if job, ok = event.Object.(*batchv1.Job); !ok {
+				return false, fmt.Errorf("unexpected object %T", event.Object)
+			}
+			log.Printf("job %q: %d active, %d succeeded, %d failed\n", name, job.Status.Active, job.Status.Succeeded, job.Status.Failed)
+			return jobFinished(job)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, errs.Wrapf(err, "wait for job %s/%s", namespace, name)
+	}
+
+	log.Printf("job %q completed.\n", name)
+	return job, nil
+}
+
+// jobFinished reports whether the job completed, and fails with errs.JobFailed when it failed.
+func jobFinished(job *batchv1.Job) (bool, error) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != apiv1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return false, &errs.Error{Kind: errs.JobFailed, Op: "job " + job.Name,
+				Err: fmt.Errorf("%s: %s", condition.Reason, condition.Message)}
+		}
+	}
+	return false, nil
+}
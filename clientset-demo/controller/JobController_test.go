@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testJob(conditions ...batchv1.JobConditionType) *batchv1.Job {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pi"}}
+	for _, conditionType := range conditions {
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+			Type: conditionType, Status: apiv1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "too many retries",
+		})
+	}
+	return job
+}
+
+func TestJobFinished(t *testing.T) {
+	suspended := testJob()
+	suspended.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobSuspended, Status: apiv1.ConditionTrue}}
+	notFailed := testJob()
+	notFailed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: apiv1.ConditionFalse}}
+	tests := []struct {
+		name       string
+		job        *batchv1.Job
+		want       bool
+		wantFailed bool
+	}{
+		{name: "running", job: testJob()},
+		{name: "suspended", job: suspended},
+		{name: "failed condition not true", job: notFailed},
+		{name: "complete", job: testJob(batchv1.JobComplete), want: true},
+		{name: "failed", job: testJob(batchv1.JobFailed), wantFailed: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			finished, err := jobFinished(test.job)
+			if test.wantFailed {
+				if !errors.Is(err, errs.JobFailed) {
+					t.Fatalf("jobFinished() error = %v, want JobFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jobFinished() error = %v", err)
+			}
+			if finished != test.want {
+				t.Errorf("jobFinished() = %v, want %v", finished, test.want)
+			}
+		})
+	}
+}
+
+func TestWaitForJob(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  []watch.Event // sent on the watch after the job was listed without conditions.
+		wantErr func(error) bool
+	}{
+		{name: "complete", events: []watch.Event{{Type: watch.Modified, Object: testJob(batchv1.JobComplete)}}},
+		{
+			name:    "failed",
+			events:  []watch.Event{{Type: watch.Modified, Object: testJob(batchv1.JobFailed)}},
+			wantErr: func(err error) bool { return errors.Is(err, errs.JobFailed) },
+		},
+		{
+			name:    "deleted",
+			events:  []watch.Event{{Type: watch.Deleted, Object: testJob()}},
+			wantErr: func(err error) bool { return err != nil && !errors.Is(err, errs.JobFailed) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset(testJob())
+			clientset.PrependWatchReactor("jobs", func(k8stesting.Action) (bool, watch.Interface, error) {
+				watcher := watch.NewRaceFreeFake()
+				for _, event := range test.events {
+					watcher.Action(event.Type, event.Object)
+				}
+				return true, watcher, nil
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			job, err := NewJobController(clientset).WaitForJob(ctx, "demo", "pi")
+			if test.wantErr != nil {
+				if !test.wantErr(err) {
+					t.Fatalf("WaitForJob() error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WaitForJob() error = %v", err)
+			}
+			if finished, _ := jobFinished(job); !finished {
+				t.Errorf("WaitForJob() returned %v, want the completed job", job.Status.Conditions)
+			}
+		})
+	}
+}
+
+func TestWaitForJobAlreadyComplete(t *testing.T) {
+	clientset := fake.NewClientset(testJob(batchv1.JobComplete))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := NewJobController(clientset).WaitForJob(ctx, "demo", "pi"); err != nil {
+		t.Fatalf("WaitForJob() error = %v", err)
+	}
+}
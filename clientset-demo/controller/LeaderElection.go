@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LeaderElectionOptions configures the coordination.k8s.io Lease every replica competes for.
+// The defaults are the ones of kube-controller-manager.
+type LeaderElectionOptions struct {
+	LeaseName      string
+	LeaseNamespace string
+	// Identity tells the replicas apart, it defaults to the hostname followed by a random suffix.
+	Identity string
+	// LeaseDuration is how long the other replicas wait before taking over a lease that is not renewed.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps retrying to renew before it gives up leading.
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval between two acquire or renew attempts.
+	RetryPeriod time.Duration
+	// ReleaseOnCancel clears the lease when the context is canceled, so a successor takes over at once
+	// instead of after LeaseDuration. Leading work must be stopped by then.
+	ReleaseOnCancel bool
+}
+
+func DefaultLeaderElectionOptions(leaseName string) *LeaderElectionOptions {
+	return &LeaderElectionOptions{
+		LeaseName:       leaseName,
+		LeaseNamespace:  metav1.NamespaceDefault,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+	}
+}
+
+func (options *LeaderElectionOptions) Validate() error {
+	if options.LeaseName == "" || options.LeaseNamespace == "" {
+		return errors.New("lease name and namespace are required")
+	}
+	if options.LeaseDuration <= options.RenewDeadline {
+		return fmt.Errorf("lease duration %v must be greater than renew deadline %v", options.LeaseDuration, options.RenewDeadline)
+	}
+	if options.RetryPeriod <= 0 || options.RenewDeadline <= options.RetryPeriod {
+		return fmt.Errorf("renew deadline %v must be greater than retry period %v", options.RenewDeadline, options.RetryPeriod)
+	}
+	return nil
+}
+
+func (options *LeaderElectionOptions) identity() (string, error) {
+	if options.Identity != "" {
+		return options.Identity, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	// The suffix keeps two processes on the same host apart.
+	return hostname + "_" + string(uuid.NewUUID()), nil
+}
+
+// RunWithLeaderElection campaigns for the lease and runs callbacks.OnStartedLeading once it is acquired,
+// with a context canceled when ctx is done or leadership is lost. OnStoppedLeading is always called,
+// OnNewLeader reports every change of leader; both are optional.
+// It returns once the leading work has returned: nil when ctx is done, an error when leadership was lost,
+// after which the process should exit rather than campaign again with half-stopped state.
+func RunWithLeaderElection(ctx context.Context, clientset kubernetes.Interface, options *LeaderElectionOptions, callbacks leaderelection.LeaderCallbacks) error {
+	if err := options.Validate(); err != nil {
+		return fmt.Errorf("invalid leader election: %w", err)
+	}
+	if callbacks.OnStartedLeading == nil {
+		return errors.New("leader election: OnStartedLeading is required")
+	}
+	identity, err := options.identity()
+	if err != nil {
+		return fmt.Errorf("leader election identity: %w", err)
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, options.LeaseNamespace, options.LeaseName,
+		clientset.CoreV1(), clientset.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return err
+	}
+
+	// The elector starts the leading work in a goroutine without waiting for it, track it here.
+	// Work starting after the election returned is skipped, so leading.Wait covers every run.
+	var mu sync.Mutex
+	var leading sync.WaitGroup
+	returned := false
+	onStartedLeading, onStoppedLeading := callbacks.OnStartedLeading, callbacks.OnStoppedLeading
+	callbacks.OnStartedLeading = func(ctx context.Context) {
+		mu.Lock()
+		if returned {
+			mu.Unlock()
+			return
+		}
+		leading.Add(1)
+		mu.Unlock()
+		defer leading.Done()
+		log.Printf("%s started leading\n", identity)
+		onStartedLeading(ctx)
+	}
+	callbacks.OnStoppedLeading = func() {
+		log.Printf("%s stopped leading\n", identity)
+		if onStoppedLeading != nil {
+			onStoppedLeading()
+		}
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   options.LeaseDuration,
+		RenewDeadline:   options.RenewDeadline,
+		RetryPeriod:     options.RetryPeriod,
+		ReleaseOnCancel: options.ReleaseOnCancel,
+		Callbacks:       callbacks,
+		Name:            options.LeaseName,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Running leader election on lease %s/%s as %s\n", options.LeaseNamespace, options.LeaseName, identity)
+	electionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	elector.Run(electionCtx) // returns when ctx is done or the lease could not be renewed.
+	cancel()
+	mu.Lock()
+	returned = true
+	mu.Unlock()
+	leading.Wait()
+	if ctx.Err() == nil {
+		return fmt.Errorf("leader election lost lease %s/%s", options.LeaseNamespace, options.LeaseName)
+	}
+	return nil
+}
@@ -1,23 +1,224 @@
 package controller
 
 import (
-	"golang.org/x/net/context"
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"errors"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"log"
+	"sort"
+	"strings"
+	"time"
 )
 
+// namespacePollInterval is how often DeleteNamespaceAndWait checks whether the namespace is gone.
+const namespacePollInterval = 2 * time.Second
+
 type NamespaceController struct {
-	namespaces []string
+	controllerOptions
+	clientset kubernetes.Interface
+	cache     *Cache // serves the reads when set, see WithCache.
+}
+
+func NewNamespaceController(clientset kubernetes.Interface, options ...Option) *NamespaceController {
+	return &NamespaceController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+// WithCache serves ListNamespaces from c instead of the API server. c must be started and synced.
+// GetNamespace keeps reading from the API server, since EnsureNamespace needs to see its own writes.
+func (receiver *NamespaceController) WithCache(c *Cache) *NamespaceController {
+	receiver.cache = c
+	return receiver
+}
+
+func (receiver *NamespaceController) ListNamespaces(ctx context.Context) ([]string, error) {
+	if receiver.cache != nil {
+		cached, err := receiver.cache.NamespaceLister().List(labels.Everything())
+		if err != nil {
+			return nil, errs.Wrap("list cached namespaces", err)
+		}
+		namespaces := make([]string, 0, len(cached))
+		for _, namespace := range cached {
+			namespaces = append(namespaces, namespace.Name)
+		}
+		sort.Strings(namespaces) // same order as the API server.
+		return namespaces, nil
+	}
+
+	list := func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return receiver.clientset.CoreV1().Namespaces().List(ctx, options)
+	}
+	var namespaces []string
+	for item, err := range paging.Items[*apiv1.Namespace](ctx, list, metav1.ListOptions{}, receiver.pageSize) {
+		if err != nil {
+			return nil, errs.Wrap("list namespaces", err)
+		}
+		namespaces = append(namespaces, item.ObjectMeta.Name)
+	}
+
+	return namespaces, nil
+}
+
+func (receiver *NamespaceController) GetNamespace(ctx context.Context, name string) (*apiv1.Namespace, error) {
+	namespace, err := receiver.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get namespace %s", name)
+	}
+
+	return namespace, nil
+}
+
+func (receiver *NamespaceController) CreateNamespace(ctx context.Context, name string, labels, annotations map[string]string) (*apiv1.Namespace, error) {
+	log.Printf("Creating namespace: %s\n", name)
+	namespace := &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+	namespace, err := receiver.clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create namespace %s", name)
+	}
+
+	return namespace, nil
+}
+
+// EnsureNamespace returns the namespace, creating it with labels and annotations when it does not exist.
+// The labels and annotations of an existing namespace are left untouched.
+// It fails when the namespace is being deleted, since nothing can be created in it.
+func (receiver *NamespaceController) EnsureNamespace(ctx context.Context, name string, labels, annotations map[string]string) (*apiv1.Namespace, error) {
+	namespace, err := receiver.GetNamespace(ctx, name)
+	if errors.Is(err, errs.NotFound) {
+		namespace, err = receiver.CreateNamespace(ctx, name, labels, annotations)
+		if errors.Is(err, errs.AlreadyExists) { // created concurrently.
+			namespace, err = receiver.GetNamespace(ctx, name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if namespace.Status.Phase == apiv1.NamespaceTerminating {
+		return nil, &errs.Error{Kind: errs.Conflict, Op: "ensure namespace " + name, Err: fmt.Errorf("namespace is terminating")}
+	}
+
+	return namespace, nil
 }
 
-func (receiver *NamespaceController) ListNamespaces(clientset *kubernetes.Clientset) []string {
-	namespaceList, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+// DeleteNamespaceAndWait deletes the namespace and waits until it is gone, logging what keeps it in the
+// Terminating phase whenever that changes. When ctx expires first, the error lists the last blockers.
+func (receiver *NamespaceController) DeleteNamespaceAndWait(ctx context.Context, name string) error {
+	log.Printf("Deleting namespace: %s\n", name)
+	err := receiver.clientset.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errs.Wrapf(err, "delete namespace %s", name)
+	}
+
+	var last *apiv1.Namespace
+	var reported string
+	err = wait.PollUntilContextCancel(ctx, namespacePollInterval, true, func(ctx context.Context) (bool, error) {
+		namespace, err := receiver.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		last = namespace
+		if namespace.Status.Phase != apiv1.NamespaceTerminating {
+			log.Printf("namespace %s is %s, waiting...\n", name, namespace.Status.Phase)
+			return false, nil
+		}
+		if blockers := terminationBlockers(namespace); blockers != reported {
+			log.Printf("namespace %s is Terminating, waiting for %s\n", name, blockers)
+			reported = blockers
+		}
+		return false, nil
+	})
 	if err != nil {
-		panic(err)
+		if last != nil && (ctx.Err() != nil || wait.Interrupted(err)) {
+			err = fmt.Errorf("%w, namespace still %s: %s", err, last.Status.Phase, terminationBlockers(last))
+		}
+		return errs.Wrapf(err, "wait for namespace %s deletion", name)
 	}
-	for _, item := range namespaceList.Items {
-		receiver.namespaces = append(receiver.namespaces, item.ObjectMeta.Name)
+
+	log.Printf("Deleted namespace: %s\n", name)
+	return nil
+}
+
+// terminationBlockers describes the finalizers and the deletion conditions of a terminating namespace.
+func terminationBlockers(namespace *apiv1.Namespace) string {
+	var blockers []string
+	if len(namespace.Spec.Finalizers) > 0 {
+		finalizers := make([]string, 0, len(namespace.Spec.Finalizers))
+		for _, finalizer := range namespace.Spec.Finalizers {
+			finalizers = append(finalizers, string(finalizer))
+		}
+		blockers = append(blockers, "spec.finalizers "+strings.Join(finalizers, ", "))
+	}
+	if len(namespace.Finalizers) > 0 {
+		blockers = append(blockers, "metadata.finalizers "+strings.Join(namespace.Finalizers, ", "))
+	}
+	for _, condition := range namespace.Status.Conditions {
+		if condition.Status == apiv1.ConditionTrue {
+			blockers = append(blockers, fmt.Sprintf("%s: %s", condition.Type, condition.Message))
+		}
+	}
+	if len(blockers) == 0 {
+		return "no finalizer reported"
 	}
 
-	return receiver.namespaces
+	return strings.Join(blockers, "; ")
+}
+
+// UpdateNamespace edits the metadata of a namespace with mutate, its spec and status are not writable here.
+// SetNamespaceLabels and SetNamespaceAnnotations cover the usual cases.
+func (receiver *NamespaceController) UpdateNamespace(ctx context.Context, name string, mutate MutateFunc[*apiv1.Namespace]) (*apiv1.Namespace, error) {
+	namespace, err := updateNamed(ctx, receiver.backoff, receiver.clientset.CoreV1().Namespaces(), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update namespace %s", name)
+	}
+
+	return namespace, nil
+}
+
+// SetNamespaceLabels adds or overwrites the labels in set and removes the ones in remove.
+func (receiver *NamespaceController) SetNamespaceLabels(ctx context.Context, name string, set map[string]string, remove ...string) (*apiv1.Namespace, error) {
+	return receiver.UpdateNamespace(ctx, name, func(namespace *apiv1.Namespace) error {
+		namespace.Labels = mergeStringMap(namespace.Labels, set, remove)
+		return nil
+	})
+}
+
+// SetNamespaceAnnotations adds or overwrites the annotations in set and removes the ones in remove.
+func (receiver *NamespaceController) SetNamespaceAnnotations(ctx context.Context, name string, set map[string]string, remove ...string) (*apiv1.Namespace, error) {
+	return receiver.UpdateNamespace(ctx, name, func(namespace *apiv1.Namespace) error {
+		namespace.Annotations = mergeStringMap(namespace.Annotations, set, remove)
+		return nil
+	})
+}
+
+func mergeStringMap(current, set map[string]string, remove []string) map[string]string {
+	if current == nil && len(set) > 0 {
+		current = make(map[string]string, len(set))
+	}
+	for key, value := range set {
+		current[key] = value
+	}
+	for _, key := range remove {
+		delete(current, key)
+	}
+	return current
 }
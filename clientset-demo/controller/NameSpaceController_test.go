@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"bytes"
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func namespace(name string, phase apiv1.NamespacePhase, labels map[string]string) *apiv1.Namespace {
+	return &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status:     apiv1.NamespaceStatus{Phase: phase},
+	}
+}
+
+func TestEnsureNamespace(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    []*apiv1.Namespace
+		wantLabels  map[string]string
+		wantCreates int
+		wantErr     error
+	}{
+		{
+			name:        "missing namespace is created",
+			wantLabels:  map[string]string{"team": "web"},
+			wantCreates: 1,
+		},
+		{
+			name:        "existing labels are kept",
+			existing:    []*apiv1.Namespace{namespace("demo", apiv1.NamespaceActive, map[string]string{"team": "db"})},
+			wantLabels:  map[string]string{"team": "db"},
+			wantCreates: 0,
+		},
+		{
+			name:     "terminating namespace",
+			existing: []*apiv1.Namespace{namespace("demo", apiv1.NamespaceTerminating, nil)},
+			wantErr:  errs.Conflict,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset()
+			for _, existing := range test.existing {
+				if err := clientset.Tracker().Add(existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := NewNamespaceController(clientset).EnsureNamespace(context.Background(), "demo", map[string]string{"team": "web"}, nil)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("EnsureNamespace() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EnsureNamespace() error = %v", err)
+			}
+			if !maps.Equal(got.Labels, test.wantLabels) {
+				t.Errorf("labels = %v, want %v", got.Labels, test.wantLabels)
+			}
+			if creates := countActions(clientset, "create", "namespaces"); creates != test.wantCreates {
+				t.Errorf("EnsureNamespace() sent %d creates, want %d", creates, test.wantCreates)
+			}
+		})
+	}
+}
+
+func TestNamespaceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	controller := NewNamespaceController(clientset, WithPageSize(1))
+
+	for _, name := range []string{"b", "a"} {
+		if _, err := controller.CreateNamespace(ctx, name, map[string]string{"env": "dev"}, nil); err != nil {
+			t.Fatalf("CreateNamespace(%s) error = %v", name, err)
+		}
+	}
+	if _, err := controller.CreateNamespace(ctx, "a", nil, nil); !errors.Is(err, errs.AlreadyExists) {
+		t.Errorf("second CreateNamespace() error = %v, want AlreadyExists", err)
+	}
+
+	names, err := controller.ListNamespaces(ctx)
+	if err != nil {
+		t.Fatalf("ListNamespaces() error = %v", err)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("ListNamespaces() = %v, want [a b]", names)
+	}
+
+	if _, err := controller.SetNamespaceLabels(ctx, "a", map[string]string{"team": "web"}, "env"); err != nil {
+		t.Fatalf("SetNamespaceLabels() error = %v", err)
+	}
+	got, err := controller.GetNamespace(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetNamespace() error = %v", err)
+	}
+	if want := map[string]string{"team": "web"}; !maps.Equal(got.Labels, want) {
+		t.Errorf("labels = %v, want %v", got.Labels, want)
+	}
+
+	if err := controller.DeleteNamespaceAndWait(ctx, "a"); err != nil {
+		t.Fatalf("DeleteNamespaceAndWait() error = %v", err)
+	}
+	if _, err := controller.GetNamespace(ctx, "a"); !errors.Is(err, errs.NotFound) {
+		t.Errorf("GetNamespace() after delete error = %v, want NotFound", err)
+	}
+	if err := controller.DeleteNamespaceAndWait(ctx, "a"); err != nil {
+		t.Errorf("DeleteNamespaceAndWait() of a missing namespace error = %v, want none", err)
+	}
+}
+
+func TestDeleteNamespaceAndWaitStuck(t *testing.T) {
+	stuck := namespace("demo", apiv1.NamespaceTerminating, nil)
+	stuck.Spec.Finalizers = []apiv1.FinalizerName{apiv1.FinalizerKubernetes}
+	stuck.Status.Conditions = []apiv1.NamespaceCondition{{
+		Type: apiv1.NamespaceDeletionContentFailure, Status: apiv1.ConditionTrue, Message: "webhook unavailable",
+	}}
+	clientset := fake.NewClientset(stuck)
+	clientset.PrependReactor("delete", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil // the finalizers keep the namespace around.
+	})
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := NewNamespaceController(clientset).DeleteNamespaceAndWait(ctx, "demo")
+	if !errors.Is(err, errs.Timeout) || !strings.Contains(err.Error(), "webhook unavailable") {
+		t.Errorf("DeleteNamespaceAndWait() error = %v, want a timeout listing the blockers", err)
+	}
+	if !strings.Contains(logs.String(), "waiting for spec.finalizers kubernetes") {
+		t.Errorf("DeleteNamespaceAndWait() logged %q, want the stuck finalizers", logs.String())
+	}
+}
+
+func TestMergeStringMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		current map[string]string
+		set     map[string]string
+		remove  []string
+		want    map[string]string
+	}{
+		{name: "nil stays nil", want: nil},
+		{name: "set on nil", set: map[string]string{"a": "1"}, want: map[string]string{"a": "1"}},
+		{name: "overwrite", current: map[string]string{"a": "1"}, set: map[string]string{"a": "2"}, want: map[string]string{"a": "2"}},
+		{name: "remove", current: map[string]string{"a": "1", "b": "2"}, remove: []string{"a", "missing"}, want: map[string]string{"b": "2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := mergeStringMap(test.current, test.set, test.remove)
+			if !maps.Equal(got, test.want) || (test.want == nil) != (got == nil) {
+				t.Errorf("mergeStringMap() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+)
+
+const (
+	// managedByLabel marks the objects created by this program.
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "clientset-demo"
+
+	resourceQuotaName = "default-quota"
+	limitRangeName    = "default-limits"
+	defaultDenyName   = "default-deny"
+)
+
+// NamespaceProfile is the template of a team namespace: its metadata and the guard-rail objects created in it.
+// A nil ResourceQuota or LimitRange and an empty DefaultDeny skip the corresponding object.
+type NamespaceProfile struct {
+	Labels        map[string]string
+	Annotations   map[string]string
+	ResourceQuota *apiv1.ResourceQuotaSpec
+	LimitRange    *apiv1.LimitRangeSpec
+	// DefaultDeny lists the traffic directions denied by the "default-deny" NetworkPolicy.
+	DefaultDeny []networkingv1.PolicyType
+}
+
+// DefaultNamespaceProfile returns the profile we give to every team namespace.
+func DefaultNamespaceProfile() *NamespaceProfile {
+	return &NamespaceProfile{
+		ResourceQuota: &apiv1.ResourceQuotaSpec{
+			Hard: apiv1.ResourceList{
+				apiv1.ResourceRequestsCPU:    resource.MustParse("4"),
+				apiv1.ResourceRequestsMemory: resource.MustParse("8Gi"),
+				apiv1.ResourceLimitsCPU:      resource.MustParse("8"),
+				apiv1.ResourceLimitsMemory:   resource.MustParse("16Gi"),
+				apiv1.ResourcePods:           resource.MustParse("50"),
+			},
+		},
+		LimitRange: &apiv1.LimitRangeSpec{
+			Limits: []apiv1.LimitRangeItem{
+				{
+					Type: apiv1.LimitTypeContainer,
+					Default: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse("500m"),
+						apiv1.ResourceMemory: resource.MustParse("512Mi"),
+					},
+					DefaultRequest: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse("100m"),
+						apiv1.ResourceMemory: resource.MustParse("128Mi"),
+					},
+				},
+			},
+		},
+		DefaultDeny: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+	}
+}
+
+// BootstrapNamespace ensures the namespace exists and reconciles the objects of profile in it.
+func (receiver *NamespaceController) BootstrapNamespace(ctx context.Context, name string, profile *NamespaceProfile) error {
+	if _, err := receiver.EnsureNamespace(ctx, name, profile.Labels, profile.Annotations); err != nil {
+		return err
+	}
+
+	return receiver.ReconcileNamespaceProfile(ctx, name, profile)
+}
+
+// ReconcileNamespaceProfile brings the metadata and the guard-rail objects of the namespace back in line
+// with profile, recreating deleted objects and reverting edited ones. Up-to-date objects are not written.
+func (receiver *NamespaceController) ReconcileNamespaceProfile(ctx context.Context, name string, profile *NamespaceProfile) error {
+	log.Printf("Reconciling namespace profile: %s\n", name)
+	if _, err := receiver.UpdateNamespace(ctx, name, func(namespace *apiv1.Namespace) error {
+		namespace.Labels = mergeStringMap(namespace.Labels, profile.Labels, nil)
+		namespace.Annotations = mergeStringMap(namespace.Annotations, profile.Annotations, nil)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if profile.ResourceQuota != nil {
+		if err := receiver.reconcileResourceQuota(ctx, name, profile.ResourceQuota); err != nil {
+			return err
+		}
+	}
+	if profile.LimitRange != nil {
+		if err := receiver.reconcileLimitRange(ctx, name, profile.LimitRange); err != nil {
+			return err
+		}
+	}
+	if len(profile.DefaultDeny) > 0 {
+		if err := receiver.reconcileDefaultDeny(ctx, name, profile.DefaultDeny); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func managedObjectMeta(namespace, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Namespace: namespace,
+		Name:      name,
+		Labels:    map[string]string{managedByLabel: managedByValue},
+	}
+}
+
+func logReconciled(kind, namespace, name string, created bool) {
+	if created {
+		log.Printf("created %s %s/%s\n", kind, namespace, name)
+	} else {
+		log.Printf("reconciled %s %s/%s\n", kind, namespace, name)
+	}
+}
+
+func (receiver *NamespaceController) reconcileResourceQuota(ctx context.Context, namespace string, spec *apiv1.ResourceQuotaSpec) error {
+	client := receiver.clientset.CoreV1().ResourceQuotas(namespace)
+	_, created, err := createOrUpdate(ctx, receiver.backoff,
+		func(ctx context.Context) (*apiv1.ResourceQuota, error) {
+			return client.Get(ctx, resourceQuotaName, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*apiv1.ResourceQuota, error) {
+			quota := &apiv1.ResourceQuota{ObjectMeta: managedObjectMeta(namespace, resourceQuotaName), Spec: *spec.DeepCopy()}
+			return client.Create(ctx, quota, metav1.CreateOptions{})
+		},
+		func(ctx context.Context, quota *apiv1.ResourceQuota) (*apiv1.ResourceQuota, error) {
+			return client.Update(ctx, quota, metav1.UpdateOptions{})
+		},
+		func(quota *apiv1.ResourceQuota) error {
+			quota.Spec = *spec.DeepCopy()
+			return nil
+		})
+	if err != nil {
+		return errs.Wrapf(err, "reconcile resourcequota %s/%s", namespace, resourceQuotaName)
+	}
+
+	logReconciled("resourcequota", namespace, resourceQuotaName, created)
+	return nil
+}
+
+func (receiver *NamespaceController) reconcileLimitRange(ctx context.Context, namespace string, spec *apiv1.LimitRangeSpec) error {
+	client := receiver.clientset.CoreV1().LimitRanges(namespace)
+	_, created, err := createOrUpdate(ctx, receiver.backoff,
+		func(ctx context.Context) (*apiv1.LimitRange, error) {
+			return client.Get(ctx, limitRangeName, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*apiv1.LimitRange, error) {
+			limitRange := &apiv1.LimitRange{ObjectMeta: managedObjectMeta(namespace, limitRangeName), Spec: *spec.DeepCopy()}
+			return client.Create(ctx, limitRange, metav1.CreateOptions{})
+		},
+		func(ctx context.Context, limitRange *apiv1.LimitRange) (*apiv1.LimitRange, error) {
+			return client.Update(ctx, limitRange, metav1.UpdateOptions{})
+		},
+		func(limitRange *apiv1.LimitRange) error {
+			limitRange.Spec = *spec.DeepCopy()
+			return nil
+		})
+	if err != nil {
+		return errs.Wrapf(err, "reconcile limitrange %s/%s", namespace, limitRangeName)
+	}
+
+	logReconciled("limitrange", namespace, limitRangeName, created)
+	return nil
+}
+
+func (receiver *NamespaceController) reconcileDefaultDeny(ctx context.Context, namespace string, policyTypes []networkingv1.PolicyType) error {
+	client := receiver.clientset.NetworkingV1().NetworkPolicies(namespace)
+	// An empty pod selector selects every pod, and no rules for a policy type deny all of that traffic.
+	spec := networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{},
+		PolicyTypes: policyTypes,
+	}
+	_, created, err := createOrUpdate(ctx, receiver.backoff,
+		func(ctx context.Context) (*networkingv1.NetworkPolicy, error) {
+			return client.Get(ctx, defaultDenyName, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*networkingv1.NetworkPolicy, error) {
+			policy := &networkingv1.NetworkPolicy{ObjectMeta: managedObjectMeta(namespace, defaultDenyName), Spec: spec}
+			return client.Create(ctx, policy, metav1.CreateOptions{})
+		},
+		func(ctx context.Context, policy *networkingv1.NetworkPolicy) (*networkingv1.NetworkPolicy, error) {
+			return client.Update(ctx, policy, metav1.UpdateOptions{})
+		},
+		func(policy *networkingv1.NetworkPolicy) error {
+			policy.Spec = *spec.DeepCopy()
+			return nil
+		})
+	if err != nil {
+		return errs.Wrapf(err, "reconcile networkpolicy %s/%s", namespace, defaultDenyName)
+	}
+
+	logReconciled("networkpolicy", namespace, defaultDenyName, created)
+	return nil
+}
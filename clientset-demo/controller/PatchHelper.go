@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"encoding/json"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// JSONPatchOperation is one operation of an RFC 6902 JSON Patch, e.g.
+//
+//	{Op: "replace", Path: "/spec/replicas", Value: 2}
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MarshalJSON writes value for the operations that take one, add, replace and test, even when it is null,
+// and leaves it out of the others.
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	type operation JSONPatchOperation // without this method.
+	switch o.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			operation
+			Value interface{} `json:"value"`
+		}{operation(o), o.Value})
+	}
+	o.Value = nil
+
+	return json.Marshal(operation(o))
+}
+
+// NewJSONPatch serializes operations into the body of a types.JSONPatchType patch.
+func NewJSONPatch(operations ...JSONPatchOperation) ([]byte, error) {
+	return json.Marshal(operations)
+}
+
+// CreateStrategicMergePatch computes the minimal strategic merge patch turning original into modified.
+// Both must be of the same built-in type, e.g. *appsv1.Deployment.
+func CreateStrategicMergePatch(original, modified runtime.Object) ([]byte, error) {
+	return strategicMergePatch(original, modified, original)
+}
+
+// strategicMergePatch diffs any two values of dataStruct's type, which carries the patch strategy tags.
+func strategicMergePatch(original, modified, dataStruct interface{}) ([]byte, error) {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return nil, err
+	}
+
+	return strategicpatch.CreateTwoWayMergePatch(originalJSON, modifiedJSON, dataStruct)
+}
+
+// applyConfiguration serializes object as a server-side apply body. Apply needs apiVersion and kind,
+// which typed objects usually lack, and rejects managedFields.
+func applyConfiguration(object runtime.Object, gvk schema.GroupVersionKind) ([]byte, error) {
+	object = object.DeepCopyObject()
+	object.GetObjectKind().SetGroupVersionKind(gvk)
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return nil, err
+	}
+	accessor.SetManagedFields(nil)
+
+	return json.Marshal(object)
+}
@@ -0,0 +1,28 @@
+package controller
+
+import "testing"
+
+func TestNewJSONPatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation JSONPatchOperation
+		want      string
+	}{
+		{name: "replace", operation: JSONPatchOperation{Op: "replace", Path: "/spec/replicas", Value: 2}, want: `[{"op":"replace","path":"/spec/replicas","value":2}]`},
+		{name: "null value kept", operation: JSONPatchOperation{Op: "replace", Path: "/spec/paused", Value: nil}, want: `[{"op":"replace","path":"/spec/paused","value":null}]`},
+		{name: "test against null", operation: JSONPatchOperation{Op: "test", Path: "/spec/paused"}, want: `[{"op":"test","path":"/spec/paused","value":null}]`},
+		{name: "remove has no value", operation: JSONPatchOperation{Op: "remove", Path: "/spec/paused", Value: true}, want: `[{"op":"remove","path":"/spec/paused"}]`},
+		{name: "move", operation: JSONPatchOperation{Op: "move", From: "/a", Path: "/b"}, want: `[{"op":"move","path":"/b","from":"/a"}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewJSONPatch(test.operation)
+			if err != nil {
+				t.Fatalf("NewJSONPatch() error = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("NewJSONPatch() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
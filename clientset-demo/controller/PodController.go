@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultContainerAnnotation selects the container of a multi-container pod when none is given, as in kubectl.
+	defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+	// evictionRetryInterval is how often EvictPod retries while a PodDisruptionBudget blocks the eviction.
+	evictionRetryInterval = 5 * time.Second
+)
+
+// PodController streams logs from pods, runs commands in them, forwards ports to them and evicts them.
+// Exec and port-forward open streaming connections, hence the rest.Config next to the clientset.
+type PodController struct {
+	controllerOptions
+	clientset  kubernetes.Interface
+	restConfig *rest.Config
+}
+
+func NewPodController(clientset kubernetes.Interface, restConfig *rest.Config, options ...Option) *PodController {
+	return &PodController{clientset: clientset, restConfig: restConfig, controllerOptions: newControllerOptions(options)}
+}
+
+func (receiver *PodController) GetPod(ctx context.Context, namespace, name string) (*apiv1.Pod, error) {
+	pod, err := receiver.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get pod %s/%s", namespace, name)
+	}
+
+	return pod, nil
+}
+
+// ListPods lists the pods of namespace matching labelSelector, empty for all of them.
+func (receiver *PodController) ListPods(ctx context.Context, namespace, labelSelector string) (*apiv1.PodList, error) {
+	list, err := paging.List(ctx, receiver.clientset.CoreV1().Pods(namespace).List, metav1.ListOptions{LabelSelector: labelSelector}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list pods in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// StreamLogs copies the logs of a container of the pod to out, like "kubectl logs".
+// options selects the container (see container), Follow, Previous, SinceSeconds/SinceTime, TailLines and Timestamps.
+// With Follow it returns when the container exits or ctx is done.
+func (receiver *PodController) StreamLogs(ctx context.Context, namespace, name string, options apiv1.PodLogOptions, out io.Writer) error {
+	pod, err := receiver.GetPod(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if options.Container, err = container(pod, options.Container); err != nil {
+		return err
+	}
+	stream, err := receiver.clientset.CoreV1().Pods(namespace).GetLogs(name, &options).Stream(ctx)
+	if err != nil {
+		return errs.Wrapf(err, "stream logs of %s/%s[%s]", namespace, name, options.Container)
+	}
+	defer stream.Close()
+
+	if _, err := io.Copy(out, stream); err != nil && ctx.Err() == nil {
+		return errs.Wrapf(err, "stream logs of %s/%s[%s]", namespace, name, options.Container)
+	}
+	return nil
+}
+
+// ExecOptions describes a command run in a container by Exec.
+type ExecOptions struct {
+	Container string   // see container.
+	Command   []string // e.g. []string{"nginx", "-t"}.
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer // ignored with TTY, the terminal merges it into Stdout.
+	TTY       bool
+	// TerminalSizeQueue, with TTY, resizes the remote terminal along with the local one, see util.Terminal.
+	TerminalSizeQueue remotecommand.TerminalSizeQueue
+}
+
+// Exec runs a command in a container of the pod, like "kubectl exec". The streams go over a websocket,
+// or over SPDY when the API server or a proxy in between does not support websockets.
+// A command exiting with a non-zero code returns a k8s.io/client-go/util/exec.ExitError.
+func (receiver *PodController) Exec(ctx context.Context, namespace, name string, options ExecOptions) error {
+	pod, err := receiver.GetPod(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+		return &errs.Error{Kind: errs.Conflict, Op: fmt.Sprintf("exec in pod %s/%s", namespace, name),
+			Err: fmt.Errorf("pod is %s", pod.Status.Phase)}
+	}
+	containerName, err := container(pod, options.Container)
+	if err != nil {
+		return err
+	}
+
+	request := receiver.clientset.CoreV1().RESTClient().Post().
+		Namespace(namespace).
+		Resource("pods").
+		Name(name).
+		SubResource("exec").
+		VersionedParams(&apiv1.PodExecOptions{
+			Container: containerName,
+			Command:   options.Command,
+			Stdin:     options.Stdin != nil,
+			Stdout:    options.Stdout != nil,
+			Stderr:    options.Stderr != nil && !options.TTY,
+			TTY:       options.TTY,
+		}, scheme.ParameterCodec)
+	executor, err := receiver.executor(request.URL())
+	if err != nil {
+		return err
+	}
+
+	streamOptions := remotecommand.StreamOptions{Stdin: options.Stdin, Stdout: options.Stdout, Tty: options.TTY}
+	if options.TTY {
+		streamOptions.TerminalSizeQueue = options.TerminalSizeQueue
+	} else {
+		streamOptions.Stderr = options.Stderr
+	}
+	if err := executor.StreamWithContext(ctx, streamOptions); err != nil {
+		return fmt.Errorf("exec %q in %s/%s[%s]: %w", strings.Join(options.Command, " "), namespace, name, containerName, err)
+	}
+	return nil
+}
+
+// executor is the websocket executor falling back to SPDY, the choice of kubectl.
+func (receiver *PodController) executor(url *url.URL) (remotecommand.Executor, error) {
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(receiver.restConfig, "GET", url.String())
+	if err != nil {
+		return nil, err
+	}
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(receiver.restConfig, "POST", url)
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+}
+
+// PortForward forwards local ports to ports of the pod until ctx is done, like "kubectl port-forward".
+// ports are "LOCAL:REMOTE" or "PORT" for the same port on both sides, a LOCAL of 0 picks a free port.
+// ready, when not nil, is closed once listening; the ports actually used are printed to out.
+func (receiver *PodController) PortForward(ctx context.Context, namespace, name string, ports []string, ready chan struct{}, out io.Writer) error {
+	pod, err := receiver.GetPod(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if pod.Status.Phase != apiv1.PodRunning {
+		return &errs.Error{Kind: errs.Conflict, Op: fmt.Sprintf("port-forward to pod %s/%s", namespace, name),
+			Err: fmt.Errorf("pod is %s, not Running", pod.Status.Phase)}
+	}
+
+	url := receiver.clientset.CoreV1().RESTClient().Post().
+		Namespace(namespace).
+		Resource("pods").
+		Name(name).
+		SubResource("portforward").
+		URL()
+	transport, upgrader, err := spdy.RoundTripperFor(receiver.restConfig)
+	if err != nil {
+		return err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", url)
+	// Prefer tunneling SPDY over a websocket, as kubectl does, and fall back to plain SPDY.
+	websocketDialer, err := portforward.NewSPDYOverWebsocketDialer(url, receiver.restConfig)
+	if err != nil {
+		return err
+	}
+	dialer = portforward.NewFallbackDialer(websocketDialer, dialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+
+	if ready == nil {
+		ready = make(chan struct{})
+	}
+	forwarder, err := portforward.New(dialer, ports, ctx.Done(), ready, out, out)
+	if err != nil {
+		return err
+	}
+	log.Printf("Forwarding ports %s to pod %s/%s\n", strings.Join(ports, ", "), namespace, name)
+	if err := forwarder.ForwardPorts(); err != nil {
+		return errs.Wrapf(err, "port-forward to pod %s/%s", namespace, name)
+	}
+	return nil
+}
+
+// EvictPod evicts the pod through the policy/v1 Eviction subresource, like "kubectl drain" does for every pod.
+// Unlike a delete, an eviction honors the PodDisruptionBudgets: while one blocks it, EvictPod retries
+// until ctx is done and then fails with errs.Conflict. gracePeriodSeconds overrides the one of the pod when not nil.
+func (receiver *PodController) EvictPod(ctx context.Context, namespace, name string, gracePeriodSeconds *int64) error {
+	log.Printf("Evicting pod: namespace: %s, name: %s\n", namespace, name)
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: gracePeriodSeconds},
+	}
+
+	var blocked error
+	err := wait.PollUntilContextCancel(ctx, evictionRetryInterval, true, func(ctx context.Context) (bool, error) {
+		err := receiver.clientset.PolicyV1().Evictions(namespace).Evict(ctx, eviction)
+		switch {
+		case err == nil, apierrors.IsNotFound(err):
+			return true, nil
+		case apierrors.IsTooManyRequests(err):
+			// A PodDisruptionBudget does not allow the disruption right now.
+			blocked = err
+			log.Printf("eviction of pod %s/%s blocked, retrying: %v\n", namespace, name, err)
+			return false, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		if blocked != nil && wait.Interrupted(err) {
+			return &errs.Error{Kind: errs.Conflict, Op: fmt.Sprintf("evict pod %s/%s", namespace, name), Err: blocked}
+		}
+		return errs.Wrapf(err, "evict pod %s/%s", namespace, name)
+	}
+
+	log.Printf("Evicted pod: namespace: %s, name: %s\n", namespace, name)
+	return nil
+}
+
+// container returns name, or picks the container of a pod when name is empty: its only container,
+// otherwise the one named by the kubectl.kubernetes.io/default-container annotation.
+func container(pod *apiv1.Pod, name string) (string, error) {
+	names := make([]string, 0, len(pod.Spec.Containers))
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	if name == "" {
+		name = pod.Annotations[defaultContainerAnnotation]
+	}
+	if name == "" {
+		if len(names) == 1 {
+			return names[0], nil
+		}
+		return "", fmt.Errorf("pod %s/%s has containers %s, choose one", pod.Namespace, pod.Name, strings.Join(names, ", "))
+	}
+	for _, container := range pod.Spec.InitContainers {
+		names = append(names, container.Name)
+	}
+	for _, candidate := range names {
+		if candidate == name {
+			return name, nil
+		}
+	}
+	return "", &errs.Error{Kind: errs.NotFound, Op: fmt.Sprintf("find container %s in pod %s/%s", name, pod.Namespace, pod.Name),
+		Err: errors.New("no such container")}
+}
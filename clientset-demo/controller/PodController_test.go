@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"errors"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestContainer(t *testing.T) {
+	pod := func(annotations map[string]string, containers ...string) *apiv1.Pod {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web", Annotations: annotations},
+			Spec:       apiv1.PodSpec{InitContainers: []apiv1.Container{{Name: "init"}}},
+		}
+		for _, name := range containers {
+			pod.Spec.Containers = append(pod.Spec.Containers, apiv1.Container{Name: name})
+		}
+		return pod
+	}
+	tests := []struct {
+		name      string
+		pod       *apiv1.Pod
+		container string
+		want      string
+		wantErr   error // nil with an empty want means any error.
+	}{
+		{name: "single container", pod: pod(nil, "nginx"), want: "nginx"},
+		{name: "named container", pod: pod(nil, "nginx", "sidecar"), container: "sidecar", want: "sidecar"},
+		{name: "default container annotation", pod: pod(map[string]string{defaultContainerAnnotation: "sidecar"}, "nginx", "sidecar"), want: "sidecar"},
+		{name: "flag over annotation", pod: pod(map[string]string{defaultContainerAnnotation: "sidecar"}, "nginx", "sidecar"), container: "nginx", want: "nginx"},
+		{name: "init container", pod: pod(nil, "nginx", "sidecar"), container: "init", want: "init"},
+		{name: "ambiguous", pod: pod(nil, "nginx", "sidecar")},
+		{name: "unknown container", pod: pod(nil, "nginx"), container: "missing", wantErr: errs.NotFound},
+		{name: "annotation naming a missing container", pod: pod(map[string]string{defaultContainerAnnotation: "gone"}, "nginx", "sidecar"), wantErr: errs.NotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := container(test.pod, test.container)
+			if test.want == "" {
+				if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+					t.Fatalf("container() = %q, %v, want error %v", got, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("container() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("container() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
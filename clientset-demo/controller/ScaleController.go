@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/scale"
+	"log"
+	"time"
+)
+
+// scalePollInterval is how often WaitForReplicas checks the scale and the pods.
+const scalePollInterval = 2 * time.Second
+
+// ScaleController changes the replicas of any resource exposing the /scale subresource: Deployments,
+// StatefulSets, ReplicaSets, ReplicationControllers and CRDs with a scale subresource, without rewriting
+// the whole object like UpdateDeployment does.
+type ScaleController struct {
+	controllerOptions
+	clientset kubernetes.Interface // lists the pods when waiting.
+	scales    scale.ScalesGetter
+	mapper    meta.RESTMapper // resolves "deployments", "statefulsets.apps", ... to their group.
+}
+
+// NewScaleController takes the scale client and RESTMapper of the factory, see factory.Factory.ScaleClient.
+func NewScaleController(clientset kubernetes.Interface, scales scale.ScalesGetter, mapper meta.RESTMapper, options ...Option) *ScaleController {
+	return &ScaleController{clientset: clientset, scales: scales, mapper: mapper, controllerOptions: newControllerOptions(options)}
+}
+
+// ScaleOptions describes a change of replicas by Scale.
+type ScaleOptions struct {
+	Replicas int32
+	// CurrentReplicas, when not nil, only scales when the resource currently wants that many replicas,
+	// like "kubectl scale --current-replicas".
+	CurrentReplicas *int32
+	// ResourceVersion, when not empty, only scales when the scale is still at that version.
+	ResourceVersion string
+	// Wait waits, without a timeout of its own, for the replicas to be ready, see WaitForReplicas.
+	Wait bool
+}
+
+func (o *ScaleOptions) Validate() error {
+	if o.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative, got %d", o.Replicas)
+	}
+	if o.CurrentReplicas != nil && *o.CurrentReplicas < 0 {
+		return fmt.Errorf("current replicas must not be negative, got %d", *o.CurrentReplicas)
+	}
+	return nil
+}
+
+// GetScale reads the scale of the resource name, resource is a kubectl style resource name like
+// "deployments", "statefulset" or "replicasets.v1.apps".
+func (receiver *ScaleController) GetScale(ctx context.Context, resource, namespace, name string) (*autoscalingv1.Scale, error) {
+	groupResource, err := receiver.groupResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	result, err := receiver.scales.Scales(namespace).Get(ctx, groupResource, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get scale of %s %s/%s", groupResource, namespace, name)
+	}
+
+	return result, nil
+}
+
+// Scale sets the replicas of the resource name through its /scale subresource, retrying on conflict.
+// A failed precondition returns errs.Conflict and is not retried.
+func (receiver *ScaleController) Scale(ctx context.Context, resource, namespace, name string, options *ScaleOptions) (*autoscalingv1.Scale, error) {
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scale of %s %s/%s: %w", resource, namespace, name, err)
+	}
+	groupResource, err := receiver.groupResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Scaling %s: namespace: %s, name: %s, replicas: %d\n", groupResource, namespace, name, options.Replicas)
+	scalesClient := receiver.scales.Scales(namespace)
+	result, err := updateWithRetry(ctx, receiver.backoff,
+		func(ctx context.Context) (*autoscalingv1.Scale, error) {
+			return scalesClient.Get(ctx, groupResource, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, scale *autoscalingv1.Scale) (*autoscalingv1.Scale, error) {
+			return scalesClient.Update(ctx, groupResource, scale, metav1.UpdateOptions{})
+		},
+		func(scale *autoscalingv1.Scale) error {
+			// Checked on every attempt: a conflict may come from a concurrent scale.
+			if options.CurrentReplicas != nil && scale.Spec.Replicas != *options.CurrentReplicas {
+				return &errs.Error{Kind: errs.Conflict, Op: "check current replicas",
+					Err: fmt.Errorf("expected %d replicas, found %d", *options.CurrentReplicas, scale.Spec.Replicas)}
+			}
+			if options.ResourceVersion != "" && scale.ResourceVersion != options.ResourceVersion {
+				return &errs.Error{Kind: errs.Conflict, Op: "check resource version",
+					Err: fmt.Errorf("expected resource version %s, found %s", options.ResourceVersion, scale.ResourceVersion)}
+			}
+			scale.Spec.Replicas = options.Replicas
+			return nil
+		})
+	if err != nil {
+		return nil, errs.Wrapf(err, "scale %s %s/%s", groupResource, namespace, name)
+	}
+
+	if options.Wait {
+		if err := receiver.WaitForReplicas(ctx, resource, namespace, name, options.Replicas); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// WaitForReplicas polls until the resource reports replicas replicas and exactly that many pods
+// matching the selector of its scale exist and are ready, terminating pods included and pods that
+// ran to completion or failed excluded.
+// Resources whose scale has no status.selector only wait for the replica count.
+func (receiver *ScaleController) WaitForReplicas(ctx context.Context, resource, namespace, name string, replicas int32) error {
+	groupResource, err := receiver.groupResource(resource)
+	if err != nil {
+		return err
+	}
+	log.Printf("Waiting for %s %q to have %d ready replicas...\n", groupResource, name, replicas)
+	lastMessage := ""
+	err = wait.PollUntilContextCancel(ctx, scalePollInterval, true, func(ctx context.Context) (bool, error) {
+		current, err := receiver.scales.Scales(namespace).Get(ctx, groupResource, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		message, done, err := receiver.scaleStatus(ctx, current, replicas)
+		if err != nil {
+			return false, err
+		}
+		if message != lastMessage {
+			log.Println(message)
+			lastMessage = message
+		}
+		return done, nil
+	})
+	if err != nil {
+		return errs.Wrapf(err, "wait for replicas of %s %s/%s", groupResource, namespace, name)
+	}
+
+	return nil
+}
+
+// scaleStatus describes how far current is from replicas ready replicas and reports whether it got there.
+func (receiver *ScaleController) scaleStatus(ctx context.Context, current *autoscalingv1.Scale, replicas int32) (string, bool, error) {
+	if current.Spec.Replicas != replicas {
+		return "", false, &errs.Error{Kind: errs.Conflict, Op: fmt.Sprintf("wait for replicas of %q", current.Name),
+			Err: fmt.Errorf("scaled to %d replicas meanwhile", current.Spec.Replicas)}
+	}
+	if current.Status.Replicas != replicas {
+		return fmt.Sprintf("Waiting for %q: %d of %d replicas...", current.Name, current.Status.Replicas, replicas), false, nil
+	}
+	if current.Status.Selector == "" {
+		return fmt.Sprintf("%q has %d replicas", current.Name, replicas), true, nil
+	}
+
+	list, err := paging.List(ctx, receiver.clientset.CoreV1().Pods(current.Namespace).List, metav1.ListOptions{LabelSelector: current.Status.Selector}, receiver.pageSize)
+	if err != nil {
+		return "", false, err
+	}
+	// Succeeded and Failed pods, e.g. evicted ones, still match the selector but are no replicas anymore.
+	pods := make([]apiv1.Pod, 0, len(list.Items))
+	for _, pod := range list.Items {
+		if pod.Status.Phase != apiv1.PodSucceeded && pod.Status.Phase != apiv1.PodFailed {
+			pods = append(pods, pod)
+		}
+	}
+	ready := int32(0)
+	for i := range pods {
+		if pods[i].DeletionTimestamp == nil && podReady(&pods[i]) {
+			ready++
+		}
+	}
+	switch {
+	case int32(len(pods)) > replicas:
+		return fmt.Sprintf("Waiting for %q: %d extra pods are pending termination...", current.Name, int32(len(pods))-replicas), false, nil
+	case ready < replicas:
+		return fmt.Sprintf("Waiting for %q: %d of %d replicas are ready...", current.Name, ready, replicas), false, nil
+	}
+
+	return fmt.Sprintf("%q has %d ready replicas", current.Name, replicas), true, nil
+}
+
+// groupResource resolves a kubectl style resource name through discovery.
+func (receiver *ScaleController) groupResource(resource string) (schema.GroupResource, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(resource)
+	if fullySpecified != nil {
+		// "a.b.c" is either resource.version.group or resource.group with a dotted group, as for CRDs.
+		if resolved, err := receiver.mapper.ResourceFor(*fullySpecified); err == nil {
+			return resolved.GroupResource(), nil
+		}
+	}
+	resolved, err := receiver.mapper.ResourceFor(groupResource.WithVersion(""))
+	if err != nil {
+		return schema.GroupResource{}, &errs.Error{Kind: errs.NotFound, Op: "resolve resource " + resource, Err: err}
+	}
+
+	return resolved.GroupResource(), nil
+}
+
+func podReady(pod *apiv1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodReady {
+			return condition.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	scalefake "k8s.io/client-go/scale/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testRESTMapper knows deployments and statefulsets, plus widgets of a CRD with a dotted group.
+func testRESTMapper() meta.RESTMapper {
+	widgets := schema.GroupVersion{Group: "example.com", Version: "v1"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{appsv1.SchemeGroupVersion, widgets})
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("StatefulSet"), meta.RESTScopeNamespace)
+	mapper.Add(widgets.WithKind("Widget"), meta.RESTScopeNamespace)
+	return mapper
+}
+
+// fakeScales serves the scale of the deployment nginx-demo, stored in *scale, and counts its updates.
+func fakeScales(scale *autoscalingv1.Scale, updates *int) *scalefake.FakeScaleClient {
+	scales := &scalefake.FakeScaleClient{}
+	scales.AddReactor("get", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, scale.DeepCopy(), nil
+	})
+	scales.AddReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*updates++
+		*scale = *action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale).DeepCopy()
+		scale.ResourceVersion += "1"
+		return true, scale.DeepCopy(), nil
+	})
+	return scales
+}
+
+func TestScalePreconditions(t *testing.T) {
+	three, five := int32(3), int32(5)
+	tests := []struct {
+		name         string
+		options      ScaleOptions
+		wantReplicas int32
+		wantUpdates  int
+		wantErr      error
+	}{
+		{name: "no precondition", options: ScaleOptions{Replicas: 1}, wantReplicas: 1, wantUpdates: 1},
+		{name: "current replicas match", options: ScaleOptions{Replicas: 1, CurrentReplicas: &three}, wantReplicas: 1, wantUpdates: 1},
+		{name: "current replicas differ", options: ScaleOptions{Replicas: 1, CurrentReplicas: &five}, wantReplicas: 3, wantErr: errs.Conflict},
+		{name: "resource version matches", options: ScaleOptions{Replicas: 1, ResourceVersion: "7"}, wantReplicas: 1, wantUpdates: 1},
+		{name: "resource version differs", options: ScaleOptions{Replicas: 1, ResourceVersion: "6"}, wantReplicas: 3, wantErr: errs.Conflict},
+		{name: "unchanged replicas", options: ScaleOptions{Replicas: 3}, wantReplicas: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scale := &autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "nginx-demo", ResourceVersion: "7"},
+				Spec:       autoscalingv1.ScaleSpec{Replicas: 3},
+			}
+			updates := 0
+			scaleController := NewScaleController(fake.NewClientset(), fakeScales(scale, &updates), testRESTMapper())
+
+			_, err := scaleController.Scale(context.Background(), "deployments", "demo", "nginx-demo", &test.options)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Scale() error = %v, want %v", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Scale() error = %v", err)
+			}
+			if scale.Spec.Replicas != test.wantReplicas || updates != test.wantUpdates {
+				t.Errorf("Scale() left %d replicas after %d updates, want %d after %d", scale.Spec.Replicas, updates, test.wantReplicas, test.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestGroupResource(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	tests := []struct {
+		resource string
+		want     schema.GroupResource
+		wantErr  error
+	}{
+		{resource: "deployments", want: deployments},
+		{resource: "deployment", want: deployments},
+		{resource: "deployments.apps", want: deployments},
+		{resource: "deployments.v1.apps", want: deployments},
+		{resource: "statefulsets", want: schema.GroupResource{Group: "apps", Resource: "statefulsets"}},
+		{resource: "widgets.example.com", want: schema.GroupResource{Group: "example.com", Resource: "widgets"}},
+		{resource: "gadgets", wantErr: errs.NotFound},
+	}
+	scaleController := NewScaleController(fake.NewClientset(), &scalefake.FakeScaleClient{}, testRESTMapper())
+	for _, test := range tests {
+		t.Run(test.resource, func(t *testing.T) {
+			got, err := scaleController.groupResource(test.resource)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("groupResource() error = %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("groupResource() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("groupResource() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScaleStatus(t *testing.T) {
+	pod := func(name string, phase apiv1.PodPhase, ready bool) *apiv1.Pod {
+		status := apiv1.ConditionFalse
+		if ready {
+			status = apiv1.ConditionTrue
+		}
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name, Labels: map[string]string{"app": "nginx-demo"}},
+			Status:     apiv1.PodStatus{Phase: phase, Conditions: []apiv1.PodCondition{{Type: apiv1.PodReady, Status: status}}},
+		}
+	}
+	terminating := pod("c", apiv1.PodRunning, true)
+	terminating.DeletionTimestamp = &metav1.Time{}
+	terminating.Finalizers = []string{"example.com/hold"}
+	tests := []struct {
+		name     string
+		pods     []runtime.Object
+		wantDone bool
+	}{
+		{name: "ready", pods: []runtime.Object{pod("a", apiv1.PodRunning, true), pod("b", apiv1.PodRunning, true)}, wantDone: true},
+		{name: "evicted and completed pods ignored", pods: []runtime.Object{
+			pod("a", apiv1.PodRunning, true), pod("b", apiv1.PodRunning, true), pod("evicted", apiv1.PodFailed, false), pod("done", apiv1.PodSucceeded, false),
+		}, wantDone: true},
+		{name: "not ready", pods: []runtime.Object{pod("a", apiv1.PodRunning, true), pod("b", apiv1.PodPending, false)}},
+		{name: "terminating extra pod", pods: []runtime.Object{pod("a", apiv1.PodRunning, true), pod("b", apiv1.PodRunning, true), terminating}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scaleController := NewScaleController(fake.NewClientset(test.pods...), &scalefake.FakeScaleClient{}, testRESTMapper())
+			current := &autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "nginx-demo"},
+				Spec:       autoscalingv1.ScaleSpec{Replicas: 2},
+				Status:     autoscalingv1.ScaleStatus{Replicas: 2, Selector: "app=nginx-demo"},
+			}
+
+			message, done, err := scaleController.scaleStatus(context.Background(), current, 2)
+			if err != nil {
+				t.Fatalf("scaleStatus() error = %v", err)
+			}
+			if done != test.wantDone {
+				t.Errorf("scaleStatus() = %q, %t, want done %t", message, done, test.wantDone)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"log"
+	"os"
+)
+
+type SecretController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+}
+
+func NewSecretController(clientset kubernetes.Interface, options ...Option) *SecretController {
+	return &SecretController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+// NewOpaqueSecret builds a generic secret holding data.
+func NewOpaqueSecret(namespace, name string, data map[string][]byte) *apiv1.Secret {
+	return &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Type: apiv1.SecretTypeOpaque,
+		Data: data,
+	}
+}
+
+// NewOpaqueSecretFromFiles builds a generic secret from local files, the sources are the ones of NewConfigMapFromFiles.
+func NewOpaqueSecretFromFiles(namespace, name string, sources ...string) (*apiv1.Secret, error) {
+	data, err := readSourceFiles(sources)
+	if err != nil {
+		return nil, err
+	}
+	return NewOpaqueSecret(namespace, name, data), nil
+}
+
+// NewTLSSecret builds a kubernetes.io/tls secret, e.g. for an ingress, from PEM encoded files.
+// It fails when the key does not match the certificate.
+func NewTLSSecret(namespace, name, certFile, keyFile string) (*apiv1.Secret, error) {
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return nil, fmt.Errorf("invalid tls secret %s/%s: %w", namespace, name, err)
+	}
+
+	return &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Type: apiv1.SecretTypeTLS,
+		Data: map[string][]byte{
+			apiv1.TLSCertKey:       cert,
+			apiv1.TLSPrivateKeyKey: key,
+		},
+	}, nil
+}
+
+// dockerConfigJSON is the content of a kubernetes.io/dockerconfigjson secret, the format of ~/.docker/config.json.
+type dockerConfigJSON struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// NewDockerConfigSecret builds a kubernetes.io/dockerconfigjson secret to pull images from server,
+// e.g. harbor.dev.com, like "kubectl create secret docker-registry". Reference it in imagePullSecrets.
+func NewDockerConfigSecret(namespace, name, server, username, password, email string) (*apiv1.Secret, error) {
+	if server == "" || username == "" || password == "" {
+		return nil, fmt.Errorf("invalid docker config secret %s/%s: server, username and password are required", namespace, name)
+	}
+	config, err := json.Marshal(dockerConfigJSON{Auths: map[string]dockerConfigEntry{
+		server: {
+			Username: username,
+			Password: password,
+			Email:    email,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+		},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Type: apiv1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{apiv1.DockerConfigJsonKey: config},
+	}, nil
+}
+
+func (receiver *SecretController) CreateSecret(ctx context.Context, secret *apiv1.Secret) (*apiv1.Secret, error) {
+	log.Printf("Creating secret: namespace: %s, name: %s, type: %s\n", secret.Namespace, secret.Name, secret.Type)
+	result, err := receiver.clientset.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create secret %s/%s", secret.Namespace, secret.Name)
+	}
+
+	return result, nil
+}
+
+// EnsureSecret creates the secret, or replaces the data of the existing one with the data of secret.
+// Labels and annotations are merged into the existing ones. The type of a secret is immutable,
+// so changing it fails with errs.Conflict; delete the secret first.
+func (receiver *SecretController) EnsureSecret(ctx context.Context, secret *apiv1.Secret) (*apiv1.Secret, error) {
+	secretsClient := receiver.clientset.CoreV1().Secrets(secret.Namespace)
+	result, created, err := createOrUpdate(ctx, receiver.backoff,
+		func(ctx context.Context) (*apiv1.Secret, error) {
+			return secretsClient.Get(ctx, secret.Name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*apiv1.Secret, error) {
+			return secretsClient.Create(ctx, secret, metav1.CreateOptions{})
+		},
+		func(ctx context.Context, secret *apiv1.Secret) (*apiv1.Secret, error) {
+			return secretsClient.Update(ctx, secret, metav1.UpdateOptions{})
+		},
+		func(existing *apiv1.Secret) error {
+			if secret.Type != "" && existing.Type != secret.Type {
+				return &errs.Error{Kind: errs.Conflict, Op: "check type of secret " + secret.Name,
+					Err: fmt.Errorf("secret is of type %s, not %s", existing.Type, secret.Type)}
+			}
+			existing.Labels = mergeStringMap(existing.Labels, secret.Labels, nil)
+			existing.Annotations = mergeStringMap(existing.Annotations, secret.Annotations, nil)
+			existing.Data = secret.Data
+			return nil
+		})
+	if err != nil {
+		return nil, errs.Wrapf(err, "ensure secret %s/%s", secret.Namespace, secret.Name)
+	}
+	log.Printf("ensured secret %s/%s (created: %t)\n", secret.Namespace, secret.Name, created)
+
+	return result, nil
+}
+
+func (receiver *SecretController) GetSecret(ctx context.Context, namespace, name string) (*apiv1.Secret, error) {
+	secret, err := receiver.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get secret %s/%s", namespace, name)
+	}
+
+	return secret, nil
+}
+
+func (receiver *SecretController) ListSecrets(ctx context.Context, namespace string) (*apiv1.SecretList, error) {
+	list, err := paging.List(ctx, receiver.clientset.CoreV1().Secrets(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list secrets in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// UpdateSecret edits the data of a secret with mutate. The type can't change, nor the data once Immutable
+// is set: such secrets have to be deleted and created again.
+func (receiver *SecretController) UpdateSecret(ctx context.Context, namespace, name string, mutate MutateFunc[*apiv1.Secret]) (*apiv1.Secret, error) {
+	log.Printf("Updating secret: namespace: %s, name: %s\n", namespace, name)
+	secret, err := updateNamed(ctx, receiver.backoff, receiver.clientset.CoreV1().Secrets(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update secret %s/%s", namespace, name)
+	}
+
+	return secret, nil
+}
+
+func (receiver *SecretController) DeleteSecret(ctx context.Context, namespace, name string) error {
+	log.Printf("Deleting secret: namespace: %s, name: %s\n", namespace, name)
+	if err := receiver.clientset.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return errs.Wrapf(err, "delete secret %s/%s", namespace, name)
+	}
+
+	return nil
+}
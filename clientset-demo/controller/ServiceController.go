@@ -1,90 +1,236 @@
 package controller
 
 import (
+	"clientset-demo/errs"
+	"common/paging"
 	"context"
 	"fmt"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"log"
 )
 
 type ServiceController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+	cache     *Cache // serves the reads when set, see WithCache.
 }
 
-func NewService(namespace, name string, nodePort int32) *apiv1.Service {
+func NewServiceController(clientset kubernetes.Interface, options ...Option) *ServiceController {
+	return &ServiceController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+// WithCache serves ListServices, GetService and NodePortsInUse from c instead of the API server.
+// c must be started and synced.
+func (receiver *ServiceController) WithCache(c *Cache) *ServiceController {
+	receiver.cache = c
+	return receiver
+}
+
+func NewService(namespace, name string, options *ServiceOptions) *apiv1.Service {
+	ports := make([]apiv1.ServicePort, 0, len(options.Ports))
+	for _, port := range options.Ports {
+		ports = append(ports, port.servicePort())
+	}
+
 	svc := &apiv1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: namespace,
 			Name:      name,
+			Labels:    options.Labels,
 		},
 		Spec: apiv1.ServiceSpec{
-			Type: "NodePort",
-			Selector: map[string]string{
-				"app": "nginx-demo",
-			},
-			Ports: []apiv1.ServicePort{
-				{
-					Port: 80,
-					TargetPort: intstr.IntOrString{
-						IntVal: 80,
-					},
-					NodePort: nodePort,
-				},
-			},
+			Type:                  options.serviceType(),
+			Selector:              options.Selector,
+			Ports:                 ports,
+			ExternalName:          options.ExternalName,
+			SessionAffinity:       options.SessionAffinity,
+			ExternalTrafficPolicy: options.ExternalTrafficPolicy,
 		},
 	}
+	if options.Headless {
+		svc.Spec.ClusterIP = apiv1.ClusterIPNone
+	}
+	if options.SessionAffinityTimeoutSeconds != 0 {
+		timeoutSeconds := options.SessionAffinityTimeoutSeconds
+		svc.Spec.SessionAffinityConfig = &apiv1.SessionAffinityConfig{
+			ClientIP: &apiv1.ClientIPConfig{TimeoutSeconds: &timeoutSeconds},
+		}
+	}
 
 	return svc
 }
 
-func (receiver *ServiceController) CreateService(clientset *kubernetes.Clientset, namespace, name string, nodePort int32) (*apiv1.Service, error) {
+func (receiver *ServiceController) CreateService(ctx context.Context, namespace, name string, options *ServiceOptions) (*apiv1.Service, error) {
 	log.Printf("Creating service: namespace: %s, name: %s\n", namespace, name)
-	svc := NewService(namespace, name, nodePort)
-	service, err := clientset.CoreV1().Services(namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid service %s/%s: %w", namespace, name, err)
+	}
+	svc := NewService(namespace, name, options)
+	if err := receiver.assignNodePorts(ctx, svc); err != nil {
+		return nil, err
+	}
+	service, err := receiver.clientset.CoreV1().Services(namespace).Create(ctx, svc, metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create service %s/%s", namespace, name)
+	}
 
-	return service, err
+	return service, nil
 }
 
-func (receiver *ServiceController) ListServices(clientset *kubernetes.Clientset, namespace string) ([]string, error) {
+func (receiver *ServiceController) ListServices(ctx context.Context, namespace string) ([]string, error) {
 	var services []string
-	serviceList, err := clientset.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+	serviceList, err := receiver.listServices(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
 	for _, service := range serviceList.Items {
 		log.Printf("Listing service: namespace: %s, name: %s\n", service.Namespace, service.Name)
 		services = append(services, service.Name)
 	}
 
-	return services, err
+	return services, nil
+}
+
+// listServices lists the services of namespace, or of all namespaces, from the cache when there is one.
+func (receiver *ServiceController) listServices(ctx context.Context, namespace string) (*apiv1.ServiceList, error) {
+	if receiver.cache != nil {
+		var services []*apiv1.Service
+		var err error
+		if namespace == metav1.NamespaceAll {
+			services, err = receiver.cache.ServiceLister().List(labels.Everything())
+		} else {
+			services, err = receiver.cache.ServiceLister().Services(namespace).List(labels.Everything())
+		}
+		if err != nil {
+			return nil, errs.Wrapf(err, "list cached services in %q", namespace)
+		}
+		list := &apiv1.ServiceList{Items: make([]apiv1.Service, 0, len(services))}
+		for _, service := range services {
+			list.Items = append(list.Items, *service.DeepCopy())
+		}
+		return list, nil
+	}
+
+	list, err := paging.List(ctx, receiver.clientset.CoreV1().Services(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list services in %q", namespace)
+	}
+	return list, nil
 }
 
-func (receiver *ServiceController) GetService(clientset *kubernetes.Clientset, namespace, name string) (*apiv1.Service, error) {
-	return clientset.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+func (receiver *ServiceController) GetService(ctx context.Context, namespace, name string) (*apiv1.Service, error) {
+	if receiver.cache != nil {
+		service, err := receiver.cache.ServiceLister().Services(namespace).Get(name)
+		if err != nil {
+			return nil, errs.Wrapf(err, "get cached service %s/%s", namespace, name)
+		}
+		return service.DeepCopy(), nil
+	}
+
+	service, err := receiver.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get service %s/%s", namespace, name)
+	}
+
+	return service, nil
 }
 
-func (receiver *ServiceController) UpdateService(clientset *kubernetes.Clientset, namespace, name string, newNodePort int32) (*apiv1.Service, error) {
+// UpdateService edits a service with mutate; its cluster IPs can't change.
+// UpdateServicePort and UpdateServiceNodePort edit a single port.
+func (receiver *ServiceController) UpdateService(ctx context.Context, namespace, name string, mutate MutateFunc[*apiv1.Service]) (*apiv1.Service, error) {
 	log.Printf("Updating service: namespace: %s, name: %s\n", namespace, name)
-	service, err := receiver.GetService(clientset, namespace, name)
+	newService, err := updateNamed(ctx, receiver.backoff, receiver.clientset.CoreV1().Services(namespace), name, mutate)
 	if err != nil {
-		return nil, fmt.Errorf("GetService err: %v\n", err)
+		return nil, errs.Wrapf(err, "update service %s/%s", namespace, name)
 	}
 
-	service.Spec.Ports[0].NodePort = newNodePort
-	newService, err := clientset.CoreV1().Services(namespace).Update(context.TODO(), service, metav1.UpdateOptions{})
+	return newService, nil
+}
 
-	return newService, err
+// UpdateServicePort applies mutate to the port named portName of the service.
+// An empty portName selects the port of a single-port service.
+func (receiver *ServiceController) UpdateServicePort(ctx context.Context, namespace, name, portName string, mutate func(port *apiv1.ServicePort) error) (*apiv1.Service, error) {
+	return receiver.UpdateService(ctx, namespace, name, func(service *apiv1.Service) error {
+		port, err := findServicePort(service, portName)
+		if err != nil {
+			return err
+		}
+		return mutate(port)
+	})
 }
 
-func (receiver *ServiceController) DeleteService(clientset *kubernetes.Clientset, namespace, name string) (bool, error) {
-	log.Printf("Deleting service: namespace: %s, name: %s\n", namespace, name)
-	_, err := receiver.GetService(clientset, namespace, name)
+// UpdateServiceNodePort changes the node port of the port named portName,
+// failing with errs.Conflict when another service owns newNodePort.
+func (receiver *ServiceController) UpdateServiceNodePort(ctx context.Context, namespace, name, portName string, newNodePort int32) (*apiv1.Service, error) {
+	inUse, err := receiver.NodePortsInUse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return receiver.UpdateService(ctx, namespace, name, func(service *apiv1.Service) error {
+		port, err := findServicePort(service, portName)
+		if err != nil {
+			return err
+		}
+		port.NodePort = newNodePort
+		return checkNodePort(inUse, service, port)
+	})
+}
+
+func findServicePort(service *apiv1.Service, portName string) (*apiv1.ServicePort, error) {
+	if portName == "" && len(service.Spec.Ports) == 1 {
+		return &service.Spec.Ports[0], nil
+	}
+	for i := range service.Spec.Ports {
+		if service.Spec.Ports[i].Name == portName {
+			return &service.Spec.Ports[i], nil
+		}
+	}
+	return nil, fmt.Errorf("service %s/%s has no port named %q", service.Namespace, service.Name, portName)
+}
+
+// PatchService sends a patch of type pt, one of types.JSONPatchType, types.MergePatchType or
+// types.StrategicMergePatchType. See NewJSONPatch and CreateStrategicMergePatch to build data.
+func (receiver *ServiceController) PatchService(ctx context.Context, namespace, name string, pt types.PatchType, data []byte) (*apiv1.Service, error) {
+	log.Printf("Patching service: namespace: %s, name: %s, type: %s\n", namespace, name, pt)
+	service, err := receiver.clientset.CoreV1().Services(namespace).Patch(ctx, name, pt, data, metav1.PatchOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "patch service %s/%s", namespace, name)
+	}
+
+	return service, nil
+}
+
+// ApplyService server-side applies the fields set in service on behalf of fieldManager.
+// force takes over fields owned by other managers instead of failing with a conflict.
+func (receiver *ServiceController) ApplyService(ctx context.Context, service *apiv1.Service, fieldManager string, force bool) (*apiv1.Service, error) {
+	log.Printf("Applying service: namespace: %s, name: %s\n", service.Namespace, service.Name)
+	data, err := applyConfiguration(service, apiv1.SchemeGroupVersion.WithKind("Service"))
+	if err != nil {
+		return nil, err
+	}
+	result, err := receiver.clientset.CoreV1().Services(service.Namespace).Patch(ctx, service.Name, types.ApplyPatchType, data,
+		metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
 	if err != nil {
-		return false, fmt.Errorf("GetService err: %v\n", err)
+		return nil, errs.Wrapf(err, "apply service %s/%s", service.Namespace, service.Name)
 	}
-	err = clientset.CoreV1().Services(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+
+	return result, nil
+}
+
+func (receiver *ServiceController) DeleteService(ctx context.Context, namespace, name string) (bool, error) {
+	log.Printf("Deleting service: namespace: %s, name: %s\n", namespace, name)
+	_, err := receiver.GetService(ctx, namespace, name)
 	if err != nil {
 		return false, err
 	}
+	err = receiver.clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return false, errs.Wrapf(err, "delete service %s/%s", namespace, name)
+	}
 
 	return true, nil
 }
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func clusterIPServiceOptions() *ServiceOptions {
+	return &ServiceOptions{
+		Selector: map[string]string{"app": "nginx-demo"},
+		Ports:    []ServicePortOptions{{Name: "http", Port: 80}},
+	}
+}
+
+func TestCreateService(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *ServiceOptions
+		check   func(t *testing.T, service *apiv1.Service)
+		wantErr bool
+	}{
+		{
+			name:    "cluster ip defaults",
+			options: clusterIPServiceOptions(),
+			check: func(t *testing.T, service *apiv1.Service) {
+				if service.Spec.Type != apiv1.ServiceTypeClusterIP {
+					t.Errorf("type = %s, want ClusterIP", service.Spec.Type)
+				}
+				port := service.Spec.Ports[0]
+				if port.Protocol != apiv1.ProtocolTCP || port.TargetPort != intstr.FromInt32(80) {
+					t.Errorf("port = %+v, want TCP targeting 80", port)
+				}
+			},
+		},
+		{
+			name:    "headless",
+			options: &ServiceOptions{Headless: true, Selector: map[string]string{"app": "db"}},
+			check: func(t *testing.T, service *apiv1.Service) {
+				if service.Spec.ClusterIP != apiv1.ClusterIPNone {
+					t.Errorf("clusterIP = %q, want None", service.Spec.ClusterIP)
+				}
+			},
+		},
+		{
+			name:    "external name without target",
+			options: &ServiceOptions{Type: apiv1.ServiceTypeExternalName},
+			wantErr: true,
+		},
+		{
+			name: "node port on a cluster ip service",
+			options: &ServiceOptions{
+				Ports: []ServicePortOptions{{Port: 80, NodePort: 30080}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset()
+
+			service, err := NewServiceController(clientset).CreateService(context.Background(), "demo", "nginx", test.options)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("CreateService() succeeded, want an error")
+				}
+				if creates := countActions(clientset, "create", "services"); creates != 0 {
+					t.Errorf("invalid options sent %d creates", creates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateService() error = %v", err)
+			}
+			test.check(t, service)
+		})
+	}
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewClientset()
+	controller := NewServiceController(clientset, WithPageSize(1))
+
+	for _, name := range []string{"nginx", "web"} {
+		if _, err := controller.CreateService(ctx, "demo", name, clusterIPServiceOptions()); err != nil {
+			t.Fatalf("CreateService(%s) error = %v", name, err)
+		}
+	}
+
+	names, err := controller.ListServices(ctx, "demo")
+	if err != nil {
+		t.Fatalf("ListServices() error = %v", err)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"nginx", "web"}) {
+		t.Errorf("ListServices() = %v, want [nginx web]", names)
+	}
+
+	_, err = controller.UpdateServicePort(ctx, "demo", "nginx", "http", func(port *apiv1.ServicePort) error {
+		port.Port = 8080
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateServicePort() error = %v", err)
+	}
+	service, err := controller.GetService(ctx, "demo", "nginx")
+	if err != nil {
+		t.Fatalf("GetService() error = %v", err)
+	}
+	if service.Spec.Ports[0].Port != 8080 {
+		t.Errorf("port = %d, want 8080", service.Spec.Ports[0].Port)
+	}
+	if _, err := controller.UpdateServicePort(ctx, "demo", "nginx", "grpc", func(*apiv1.ServicePort) error { return nil }); err == nil {
+		t.Errorf("UpdateServicePort() of a missing port succeeded, want an error")
+	}
+
+	deleted, err := controller.DeleteService(ctx, "demo", "nginx")
+	if err != nil || !deleted {
+		t.Fatalf("DeleteService() = %t, %v", deleted, err)
+	}
+	if _, err := clientset.CoreV1().Services("demo").Get(ctx, "nginx", metav1.GetOptions{}); err == nil {
+		t.Errorf("service still stored after DeleteService()")
+	}
+	if deleted, err := controller.DeleteService(ctx, "demo", "nginx"); deleted || !errors.Is(err, errs.NotFound) {
+		t.Errorf("second DeleteService() = %t, %v, want NotFound", deleted, err)
+	}
+}
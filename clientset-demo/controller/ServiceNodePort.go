@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"log"
+	"sort"
+)
+
+// DefaultNodePortRange is the default --service-node-port-range of the API server.
+var DefaultNodePortRange = utilnet.PortRange{Base: 30000, Size: 2768}
+
+// NodePortOwner is the service port holding a node port.
+type NodePortOwner struct {
+	Namespace string
+	Name      string
+	PortName  string
+}
+
+func (o NodePortOwner) String() string {
+	if o.PortName == "" {
+		return fmt.Sprintf("service %s/%s", o.Namespace, o.Name)
+	}
+	return fmt.Sprintf("port %q of service %s/%s", o.PortName, o.Namespace, o.Name)
+}
+
+// WithNodePortRange sets the range the ServiceController picks node ports from, DefaultNodePortRange by default.
+// It should match the API server's one.
+func WithNodePortRange(nodePortRange utilnet.PortRange) Option {
+	return func(o *controllerOptions) {
+		o.nodePortRange = nodePortRange
+	}
+}
+
+// NodePortsInUse scans the services of all namespaces and returns the owner of every allocated node port,
+// including the health check node ports of LoadBalancer services.
+func (receiver *ServiceController) NodePortsInUse(ctx context.Context) (map[int32]NodePortOwner, error) {
+	serviceList, err := receiver.listServices(ctx, metav1.NamespaceAll)
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[int32]NodePortOwner)
+	for _, service := range serviceList.Items {
+		for _, port := range service.Spec.Ports {
+			if port.NodePort != 0 {
+				inUse[port.NodePort] = NodePortOwner{Namespace: service.Namespace, Name: service.Name, PortName: port.Name}
+			}
+		}
+		if service.Spec.HealthCheckNodePort != 0 {
+			inUse[service.Spec.HealthCheckNodePort] = NodePortOwner{Namespace: service.Namespace, Name: service.Name, PortName: "healthCheckNodePort"}
+		}
+	}
+
+	return inUse, nil
+}
+
+// FreeNodePort returns the lowest node port of the configured range that no service uses.
+func (receiver *ServiceController) FreeNodePort(ctx context.Context) (int32, error) {
+	inUse, err := receiver.NodePortsInUse(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return receiver.freeNodePort(inUse, nil)
+}
+
+func (receiver *ServiceController) freeNodePort(inUse map[int32]NodePortOwner, taken map[int32]bool) (int32, error) {
+	for port := receiver.nodePortRange.Base; port < receiver.nodePortRange.Base+receiver.nodePortRange.Size; port++ {
+		if _, ok := inUse[int32(port)]; !ok && !taken[int32(port)] {
+			return int32(port), nil
+		}
+	}
+	return 0, &errs.Error{Kind: errs.Conflict, Op: "allocate node port", Err: fmt.Errorf("no free node port in range %s", receiver.nodePortRange.String())}
+}
+
+// assignNodePorts checks the node ports requested by service against the ones in use and fills the
+// missing ones from the configured range, so that conflicts are explained before the create.
+func (receiver *ServiceController) assignNodePorts(ctx context.Context, service *apiv1.Service) error {
+	if service.Spec.Type != apiv1.ServiceTypeNodePort && service.Spec.Type != apiv1.ServiceTypeLoadBalancer {
+		return nil
+	}
+	inUse, err := receiver.NodePortsInUse(ctx)
+	if err != nil {
+		return err
+	}
+
+	taken := make(map[int32]bool)
+	for i := range service.Spec.Ports {
+		port := &service.Spec.Ports[i]
+		if port.NodePort == 0 {
+			continue
+		}
+		if err := checkNodePort(inUse, service, port); err != nil {
+			return err
+		}
+		taken[port.NodePort] = true
+	}
+	for i := range service.Spec.Ports {
+		port := &service.Spec.Ports[i]
+		if port.NodePort != 0 {
+			continue
+		}
+		if port.NodePort, err = receiver.freeNodePort(inUse, taken); err != nil {
+			return err
+		}
+		taken[port.NodePort] = true
+		log.Printf("picked free node port %d for port %q of service %s/%s\n", port.NodePort, port.Name, service.Namespace, service.Name)
+	}
+
+	return nil
+}
+
+// checkNodePort fails with errs.Conflict when the node port of port is owned by another service.
+func checkNodePort(inUse map[int32]NodePortOwner, service *apiv1.Service, port *apiv1.ServicePort) error {
+	owner, ok := inUse[port.NodePort]
+	if !ok || (owner.Namespace == service.Namespace && owner.Name == service.Name) {
+		return nil
+	}
+	return &errs.Error{
+		Kind: errs.Conflict,
+		Op:   fmt.Sprintf("service %s/%s", service.Namespace, service.Name),
+		Err:  fmt.Errorf("node port %d is already allocated to %s", port.NodePort, owner),
+	}
+}
+
+// SortedNodePorts returns the node ports of inUse in ascending order, handy for reports.
+func SortedNodePorts(inUse map[int32]NodePortOwner) []int32 {
+	ports := make([]int32, 0, len(inUse))
+	for port := range inUse {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i] < ports[j]
+	})
+	return ports
+}
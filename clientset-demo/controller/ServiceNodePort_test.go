@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func nodePortService(namespace, name string, nodePorts ...int32) *apiv1.Service {
+	service := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       apiv1.ServiceSpec{Type: apiv1.ServiceTypeNodePort},
+	}
+	for _, nodePort := range nodePorts {
+		service.Spec.Ports = append(service.Spec.Ports, apiv1.ServicePort{Port: 80, NodePort: nodePort})
+	}
+	return service
+}
+
+func TestFreeNodePort(t *testing.T) {
+	nodePortRange := utilnet.PortRange{Base: 30000, Size: 3}
+	tests := []struct {
+		name    string
+		inUse   []int32
+		taken   []int32
+		want    int32
+		wantErr bool
+	}{
+		{name: "empty range picks the base", want: 30000},
+		{name: "skips ports in use", inUse: []int32{30000, 30001}, want: 30002},
+		{name: "skips ports taken by the same service", inUse: []int32{30000}, taken: []int32{30001}, want: 30002},
+		{name: "ports outside the range are ignored", inUse: []int32{30003, 29999}, want: 30000},
+		{name: "exhausted range", inUse: []int32{30000, 30002}, taken: []int32{30001}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inUse := make(map[int32]NodePortOwner)
+			for _, port := range test.inUse {
+				inUse[port] = NodePortOwner{Namespace: "demo", Name: "other"}
+			}
+			taken := make(map[int32]bool)
+			for _, port := range test.taken {
+				taken[port] = true
+			}
+
+			got, err := NewServiceController(fake.NewClientset(), WithNodePortRange(nodePortRange)).freeNodePort(inUse, taken)
+			if test.wantErr {
+				if !errors.Is(err, errs.Conflict) {
+					t.Fatalf("freeNodePort() = %d, %v, want a Conflict", got, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("freeNodePort() = %d, %v, want %d", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckNodePort(t *testing.T) {
+	inUse := map[int32]NodePortOwner{30080: {Namespace: "demo", Name: "nginx", PortName: "http"}}
+	tests := []struct {
+		name    string
+		service *apiv1.Service
+		wantErr bool
+	}{
+		{name: "free port", service: nodePortService("demo", "web", 30081)},
+		{name: "port held by the service itself", service: nodePortService("demo", "nginx", 30080)},
+		{name: "port held by another service", service: nodePortService("demo", "web", 30080), wantErr: true},
+		{name: "same name in another namespace", service: nodePortService("other", "nginx", 30080), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkNodePort(inUse, test.service, &test.service.Spec.Ports[0])
+			if test.wantErr != errors.Is(err, errs.Conflict) {
+				t.Errorf("checkNodePort() error = %v, want conflict %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodePortsInUse(t *testing.T) {
+	loadBalancer := nodePortService("demo", "lb", 30001)
+	loadBalancer.Spec.Type = apiv1.ServiceTypeLoadBalancer
+	loadBalancer.Spec.HealthCheckNodePort = 30002
+	clientset := fake.NewClientset(nodePortService("demo", "nginx", 30000), nodePortService("other", "web", 0), loadBalancer)
+
+	inUse, err := NewServiceController(clientset).NodePortsInUse(context.Background())
+	if err != nil {
+		t.Fatalf("NodePortsInUse() error = %v", err)
+	}
+	if got := SortedNodePorts(inUse); !slices.Equal(got, []int32{30000, 30001, 30002}) {
+		t.Errorf("NodePortsInUse() = %v, want [30000 30001 30002]", got)
+	}
+	if owner := inUse[30002]; owner.Name != "lb" || owner.PortName != "healthCheckNodePort" {
+		t.Errorf("owner of 30002 = %s, want the health check of lb", owner)
+	}
+}
+
+func TestCreateServiceAssignsNodePorts(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodePort int32
+		want     int32
+		wantErr  bool
+	}{
+		{name: "free port is picked", nodePort: 0, want: 30001},
+		{name: "requested port is kept", nodePort: 30005, want: 30005},
+		{name: "requested port in use", nodePort: 30000, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewClientset(nodePortService("other", "web", 30000))
+			controller := NewServiceController(clientset, WithNodePortRange(utilnet.PortRange{Base: 30000, Size: 10}))
+
+			service, err := controller.CreateService(context.Background(), "demo", "nginx", NginxServiceOptions(test.nodePort))
+			if test.wantErr {
+				if !errors.Is(err, errs.Conflict) {
+					t.Fatalf("CreateService() error = %v, want Conflict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateService() error = %v", err)
+			}
+			if got := service.Spec.Ports[0].NodePort; got != test.want {
+				t.Errorf("nodePort = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateServiceNodePort(t *testing.T) {
+	clientset := fake.NewClientset(nodePortService("demo", "nginx", 30000), nodePortService("demo", "web", 30001))
+	controller := NewServiceController(clientset)
+
+	if _, err := controller.UpdateServiceNodePort(context.Background(), "demo", "nginx", "", 30001); !errors.Is(err, errs.Conflict) {
+		t.Errorf("UpdateServiceNodePort() to a port in use error = %v, want Conflict", err)
+	}
+	service, err := controller.UpdateServiceNodePort(context.Background(), "demo", "nginx", "", 30002)
+	if err != nil {
+		t.Fatalf("UpdateServiceNodePort() error = %v", err)
+	}
+	if got := service.Spec.Ports[0].NodePort; got != 30002 {
+		t.Errorf("nodePort = %d, want 30002", got)
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ServicePortOptions describes one port of a service.
+type ServicePortOptions struct {
+	Name       string         // required when the service has several ports.
+	Protocol   apiv1.Protocol // defaults to TCP.
+	Port       int32
+	TargetPort intstr.IntOrString // container port number or name, defaults to Port.
+	NodePort   int32              // NodePort and LoadBalancer services only, 0 lets the API server allocate one.
+}
+
+// ServiceOptions describes the service built by NewService.
+type ServiceOptions struct {
+	Type     apiv1.ServiceType // defaults to ClusterIP.
+	Headless bool              // ClusterIP "None", for ClusterIP services only.
+	Labels   map[string]string
+	Selector map[string]string
+	Ports    []ServicePortOptions
+
+	ExternalName                  string // ExternalName services only.
+	SessionAffinity               apiv1.ServiceAffinity
+	SessionAffinityTimeoutSeconds int32                              // ClientIP affinity only, 0 keeps the default.
+	ExternalTrafficPolicy         apiv1.ServiceExternalTrafficPolicy // NodePort and LoadBalancer services only.
+}
+
+// NginxServiceOptions returns the options of the nginx demo service, exposing the "http" container port on nodePort.
+func NginxServiceOptions(nodePort int32) *ServiceOptions {
+	return &ServiceOptions{
+		Type: apiv1.ServiceTypeNodePort,
+		Selector: map[string]string{
+			"app": "nginx-demo",
+		},
+		Ports: []ServicePortOptions{
+			{
+				Name:       "http",
+				Port:       80,
+				TargetPort: intstr.FromString("http"),
+				NodePort:   nodePort,
+			},
+		},
+	}
+}
+
+func (o *ServiceOptions) serviceType() apiv1.ServiceType {
+	if o.Type == "" {
+		return apiv1.ServiceTypeClusterIP
+	}
+	return o.Type
+}
+
+// Validate checks that the options describe a service the API server accepts.
+func (o *ServiceOptions) Validate() error {
+	serviceType := o.serviceType()
+	exposedOnNodes := serviceType == apiv1.ServiceTypeNodePort || serviceType == apiv1.ServiceTypeLoadBalancer
+	switch serviceType {
+	case apiv1.ServiceTypeExternalName:
+		if o.ExternalName == "" {
+			return fmt.Errorf("externalName is required for ExternalName services")
+		}
+	case apiv1.ServiceTypeClusterIP, apiv1.ServiceTypeNodePort, apiv1.ServiceTypeLoadBalancer:
+		if o.ExternalName != "" {
+			return fmt.Errorf("externalName is only valid for ExternalName services")
+		}
+		if len(o.Ports) == 0 && !o.Headless {
+			return fmt.Errorf("at least one port is required")
+		}
+	default:
+		return fmt.Errorf("unknown service type %q", serviceType)
+	}
+	if o.Headless && serviceType != apiv1.ServiceTypeClusterIP {
+		return fmt.Errorf("headless services must be of type ClusterIP, got %s", serviceType)
+	}
+	if o.ExternalTrafficPolicy != "" && !exposedOnNodes {
+		return fmt.Errorf("externalTrafficPolicy is only valid for NodePort and LoadBalancer services")
+	}
+	if o.SessionAffinityTimeoutSeconds != 0 && o.SessionAffinity != apiv1.ServiceAffinityClientIP {
+		return fmt.Errorf("sessionAffinityTimeoutSeconds requires ClientIP session affinity")
+	}
+
+	names := make(map[string]bool, len(o.Ports))
+	for i, port := range o.Ports {
+		if port.Port <= 0 || port.Port > 65535 {
+			return fmt.Errorf("ports[%d]: invalid port %d", i, port.Port)
+		}
+		if port.NodePort != 0 && !exposedOnNodes {
+			return fmt.Errorf("ports[%d]: nodePort is only valid for NodePort and LoadBalancer services", i)
+		}
+		if len(o.Ports) > 1 && port.Name == "" {
+			return fmt.Errorf("ports[%d]: name is required with multiple ports", i)
+		}
+		if names[port.Name] {
+			return fmt.Errorf("ports[%d]: duplicate port name %q", i, port.Name)
+		}
+		names[port.Name] = true
+	}
+
+	return nil
+}
+
+func (o *ServicePortOptions) servicePort() apiv1.ServicePort {
+	port := apiv1.ServicePort{
+		Name:       o.Name,
+		Protocol:   o.Protocol,
+		Port:       o.Port,
+		TargetPort: o.TargetPort,
+		NodePort:   o.NodePort,
+	}
+	if port.Protocol == "" {
+		port.Protocol = apiv1.ProtocolTCP
+	}
+	if port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal == 0 {
+		port.TargetPort = intstr.FromInt32(o.Port)
+	}
+	return port
+}
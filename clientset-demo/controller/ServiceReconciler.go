@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"log"
+	"sync"
+)
+
+const (
+	// ExposeLabel marks the deployments the ServiceReconciler keeps a service for, with the value "true".
+	ExposeLabel = "clientset-demo/expose"
+	// reconcileMaxRetries is how many times a failing key is requeued before it is dropped until its next event.
+	reconcileMaxRetries = 5
+)
+
+// ServiceReconciler is a controller loop keeping a ClusterIP service, named after the deployment,
+// for every deployment labeled ExposeLabel=true. The service selects the pods of the deployment and
+// exposes its container ports; it is owned by the deployment and deleted once the label is removed.
+//
+// Deployment and service events are reduced to the "namespace/name" key of the deployment and
+// queued on a rate-limited workqueue, so a deployment is never reconciled by two workers at once.
+type ServiceReconciler struct {
+	controllerOptions
+	clientset kubernetes.Interface
+	cache     *Cache
+	queue     workqueue.TypedRateLimitingInterface[string]
+}
+
+// NewServiceReconciler registers its event handlers on the informers of c. c is started by the caller,
+// before or after, Run waits for it to sync.
+func NewServiceReconciler(clientset kubernetes.Interface, c *Cache, options ...Option) (*ServiceReconciler, error) {
+	receiver := &ServiceReconciler{
+		clientset: clientset,
+		cache:     c,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "service-reconciler"}),
+		controllerOptions: newControllerOptions(options),
+	}
+	if _, err := c.deployments.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    receiver.enqueueDeployment,
+		UpdateFunc: func(_, newObj interface{}) { receiver.enqueueDeployment(newObj) },
+		DeleteFunc: receiver.enqueueDeployment,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := c.services.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    receiver.enqueueOwner,
+		UpdateFunc: func(_, newObj interface{}) { receiver.enqueueOwner(newObj) },
+		DeleteFunc: receiver.enqueueOwner,
+	}); err != nil {
+		return nil, err
+	}
+
+	return receiver, nil
+}
+
+func (receiver *ServiceReconciler) enqueueDeployment(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	receiver.queue.Add(key)
+}
+
+// enqueueOwner queues the deployment controlling a service, so edits and deletions of the service are undone.
+func (receiver *ServiceReconciler) enqueueOwner(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	service, ok := obj.(*apiv1.Service)
+	if !ok {
+		return
+	}
+	owner := metav1.GetControllerOf(service)
+	if owner == nil || owner.Kind != "Deployment" || owner.APIVersion != appsv1.SchemeGroupVersion.String() {
+		return
+	}
+	receiver.queue.Add(service.Namespace + "/" + owner.Name)
+}
+
+// Run waits for the cache to sync and reconciles with workers goroutines until ctx is done.
+// On shutdown the workers drain the keys already queued, retries are no longer scheduled.
+func (receiver *ServiceReconciler) Run(ctx context.Context, workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("workers must be at least 1, got %d", workers)
+	}
+	defer utilruntime.HandleCrash()
+
+	log.Println("Starting service reconciler, waiting for the cache to sync...")
+	if err := receiver.cache.WaitForCacheSync(ctx); err != nil {
+		receiver.queue.ShutDown()
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for receiver.processNextItem(ctx) {
+			}
+		}()
+	}
+	log.Printf("Started %d service reconciler workers.\n", workers)
+
+	<-ctx.Done()
+	log.Println("Shutting down service reconciler...")
+	receiver.queue.ShutDown()
+	wg.Wait()
+	log.Println("Stopped service reconciler.")
+	return nil
+}
+
+// processNextItem reconciles one key, it returns false once the queue is shut down.
+func (receiver *ServiceReconciler) processNextItem(ctx context.Context) bool {
+	key, quit := receiver.queue.Get()
+	if quit {
+		return false
+	}
+	defer receiver.queue.Done(key)
+
+	// In-flight requests are not canceled with ctx, so a shutdown never leaves a half-done reconcile,
+	// but the request timeout bounds them, so a hung API server cannot block the shutdown either.
+	reconcileCtx, cancel := receiver.withRequestTimeout(context.WithoutCancel(ctx))
+	err := receiver.Reconcile(reconcileCtx, key)
+	cancel()
+	switch {
+	case err == nil:
+		receiver.queue.Forget(key)
+	case receiver.queue.NumRequeues(key) < reconcileMaxRetries:
+		log.Printf("reconcile %s failed, retrying: %v\n", key, err)
+		receiver.queue.AddRateLimited(key)
+	default:
+		utilruntime.HandleError(fmt.Errorf("dropping %s out of the queue: %w", key, err))
+		receiver.queue.Forget(key)
+	}
+	return true
+}
+
+// Reconcile brings the service of the deployment identified by key, "namespace/name", in line:
+// it is created or updated while the deployment is labeled ExposeLabel=true and exposes ports,
+// and deleted otherwise. A service of the same name not controlled by the deployment is left alone
+// and reported as errs.Conflict.
+func (receiver *ServiceReconciler) Reconcile(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	deployment, err := receiver.cache.DeploymentLister().Deployments(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		deployment = nil
+	} else if err != nil {
+		return errs.Wrapf(err, "get cached deployment %s", key)
+	}
+
+	var desired *apiv1.Service
+	if deployment != nil && deployment.DeletionTimestamp == nil && deployment.Labels[ExposeLabel] == "true" {
+		desired = exposedService(deployment)
+	}
+	if desired == nil {
+		return receiver.deleteExposedService(ctx, namespace, name, deployment)
+	}
+
+	servicesClient := receiver.clientset.CoreV1().Services(namespace)
+	_, created, err := createOrUpdate(ctx, receiver.backoff,
+		func(ctx context.Context) (*apiv1.Service, error) {
+			return servicesClient.Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context) (*apiv1.Service, error) {
+			return servicesClient.Create(ctx, desired, metav1.CreateOptions{})
+		},
+		func(ctx context.Context, service *apiv1.Service) (*apiv1.Service, error) {
+			return servicesClient.Update(ctx, service, metav1.UpdateOptions{})
+		},
+		func(service *apiv1.Service) error {
+			if !metav1.IsControlledBy(service, deployment) {
+				return &errs.Error{Kind: errs.Conflict, Op: "check owner of service " + key,
+					Err: fmt.Errorf("service exists and is not controlled by the deployment")}
+			}
+			service.Labels = mergeStringMap(service.Labels, desired.Labels, nil)
+			service.Spec.Selector = desired.Spec.Selector
+			service.Spec.Ports = mergeServicePorts(service.Spec.Ports, desired.Spec.Ports)
+			return nil
+		})
+	if err != nil {
+		return errs.Wrapf(err, "reconcile service %s", key)
+	}
+	if created {
+		log.Printf("reconcile: created service %s\n", key)
+	}
+
+	return nil
+}
+
+// deleteExposedService deletes the service named after a deployment when the reconciler created it.
+// deployment is nil once it is gone, the service is then matched through its managed-by label.
+func (receiver *ServiceReconciler) deleteExposedService(ctx context.Context, namespace, name string, deployment *appsv1.Deployment) error {
+	service, err := receiver.cache.ServiceLister().Services(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errs.Wrapf(err, "get cached service %s/%s", namespace, name)
+	}
+	owner := metav1.GetControllerOf(service)
+	if service.Labels[managedByLabel] != managedByValue || owner == nil || owner.Kind != "Deployment" ||
+		(deployment != nil && owner.UID != deployment.UID) {
+		return nil
+	}
+
+	uid := service.UID
+	err = receiver.clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid}, // not a service recreated meanwhile.
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errs.Wrapf(err, "delete service %s/%s", namespace, name)
+	}
+	log.Printf("reconcile: deleted service %s/%s\n", namespace, name)
+	return nil
+}
+
+// exposedService is the service wanted for deployment, nil when it has no container port to expose.
+func exposedService(deployment *appsv1.Deployment) *apiv1.Service {
+	if deployment.Spec.Selector == nil || len(deployment.Spec.Selector.MatchLabels) == 0 {
+		return nil // a service selector can't express match expressions.
+	}
+	var ports []apiv1.ServicePort
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, port := range container.Ports {
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = apiv1.ProtocolTCP
+			}
+			portName := port.Name
+			if portName == "" {
+				portName = fmt.Sprintf("%s-%d", container.Name, port.ContainerPort)
+			}
+			ports = append(ports, apiv1.ServicePort{
+				Name:       portName,
+				Protocol:   protocol,
+				Port:       port.ContainerPort,
+				TargetPort: intstr.FromInt32(port.ContainerPort),
+			})
+		}
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+
+	return &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       deployment.Namespace,
+			Name:            deployment.Name,
+			Labels:          map[string]string{managedByLabel: managedByValue},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+		},
+		Spec: apiv1.ServiceSpec{
+			Type:     apiv1.ServiceTypeClusterIP,
+			Selector: deployment.Spec.Selector.MatchLabels,
+			Ports:    ports,
+		},
+	}
+}
+
+// mergeServicePorts returns desired, keeping the fields the API server defaulted on the current ports of the same name.
+func mergeServicePorts(current, desired []apiv1.ServicePort) []apiv1.ServicePort {
+	ports := make([]apiv1.ServicePort, 0, len(desired))
+	for _, port := range desired {
+		for _, existing := range current {
+			if existing.Name == port.Name {
+				port.NodePort = existing.NodePort
+				port.AppProtocol = existing.AppProtocol
+			}
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
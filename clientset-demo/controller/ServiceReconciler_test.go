@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// exposedDeployment returns the nginx demo deployment, labeled for the reconciler when expose is set.
+func exposedDeployment(expose bool) *appsv1.Deployment {
+	deployment := NewDeployment("demo", "nginx-demo", NginxDeploymentOptions())
+	deployment.UID = types.UID("deployment-uid")
+	if expose {
+		deployment.Labels[ExposeLabel] = "true"
+	}
+	return deployment
+}
+
+func TestServiceReconcilerReconcile(t *testing.T) {
+	drifted := exposedService(exposedDeployment(true))
+	drifted.Spec.Selector = map[string]string{"app": "other"}
+	drifted.Spec.Ports[0].Port = 8080
+	foreign := exposedService(exposedDeployment(true))
+	foreign.OwnerReferences = nil
+
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		wantCreates int
+		wantUpdates int
+		wantDeletes int
+		wantService bool
+		wantErr     error
+	}{
+		{
+			name:        "missing service is created",
+			objects:     []runtime.Object{exposedDeployment(true)},
+			wantCreates: 1,
+			wantService: true,
+		},
+		{
+			name:        "drifted service is updated",
+			objects:     []runtime.Object{exposedDeployment(true), drifted},
+			wantUpdates: 1,
+			wantService: true,
+		},
+		{
+			name:        "service in line is not written",
+			objects:     []runtime.Object{exposedDeployment(true), exposedService(exposedDeployment(true))},
+			wantService: true,
+		},
+		{
+			name:        "service is deleted once the label is removed",
+			objects:     []runtime.Object{exposedDeployment(false), exposedService(exposedDeployment(true))},
+			wantDeletes: 1,
+		},
+		{
+			name:        "service is deleted with the deployment",
+			objects:     []runtime.Object{exposedService(exposedDeployment(true))},
+			wantDeletes: 1,
+		},
+		{
+			name:    "unlabeled deployment without service",
+			objects: []runtime.Object{exposedDeployment(false)},
+		},
+		{
+			name:        "service not controlled by the deployment",
+			objects:     []runtime.Object{exposedDeployment(true), foreign},
+			wantService: true,
+			wantErr:     errs.Conflict,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			clientset := fake.NewClientset(test.objects...)
+			c, err := NewCache(clientset, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reconciler, err := NewServiceReconciler(clientset, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Start(ctx)
+			if err := c.WaitForCacheSync(ctx); err != nil {
+				t.Fatal(err)
+			}
+			clientset.ClearActions()
+
+			err = reconciler.Reconcile(ctx, "demo/nginx-demo")
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("Reconcile() error = %v, want %v", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			for verb, want := range map[string]int{"create": test.wantCreates, "update": test.wantUpdates, "delete": test.wantDeletes} {
+				if got := countActions(clientset, verb, "services"); got != want {
+					t.Errorf("Reconcile() sent %d %ss, want %d", got, verb, want)
+				}
+			}
+
+			service, err := clientset.CoreV1().Services("demo").Get(ctx, "nginx-demo", metav1.GetOptions{})
+			if !test.wantService {
+				if err == nil {
+					t.Errorf("service still stored after Reconcile()")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("service not stored: %v", err)
+			}
+			if test.wantErr != nil {
+				return
+			}
+			want := exposedService(exposedDeployment(true))
+			if service.Spec.Selector["app"] != want.Spec.Selector["app"] || service.Spec.Ports[0].Port != want.Spec.Ports[0].Port {
+				t.Errorf("service spec = %+v, want %+v", service.Spec, want.Spec)
+			}
+			if !metav1.IsControlledBy(service, exposedDeployment(true)) {
+				t.Errorf("service owners = %v, want the deployment", service.OwnerReferences)
+			}
+		})
+	}
+}
+
+func TestMergeServicePorts(t *testing.T) {
+	current := []apiv1.ServicePort{{Name: "http", Port: 80, NodePort: 30080}, {Name: "metrics", Port: 9090}}
+	desired := []apiv1.ServicePort{{Name: "http", Port: 8080}}
+
+	got := mergeServicePorts(current, desired)
+	if len(got) != 1 || got[0].Port != 8080 || got[0].NodePort != 30080 {
+		t.Errorf("mergeServicePorts() = %+v, want the desired http port keeping node port 30080", got)
+	}
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"clientset-demo/errs"
+	"common/paging"
+	"context"
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"log"
+)
+
+type StatefulSetController struct {
+	controllerOptions
+	clientset kubernetes.Interface
+}
+
+func NewStatefulSetController(clientset kubernetes.Interface, options ...Option) *StatefulSetController {
+	return &StatefulSetController{clientset: clientset, controllerOptions: newControllerOptions(options)}
+}
+
+func NewStatefulSet(namespace, name string, options *StatefulSetOptions) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    options.Labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: options.Replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: options.selector(),
+			},
+			Template:             options.podTemplate(name),
+			VolumeClaimTemplates: options.VolumeClaimTemplates,
+			ServiceName:          options.ServiceName,
+			PodManagementPolicy:  options.PodManagementPolicy,
+		},
+	}
+}
+
+func (receiver *StatefulSetController) CreateStatefulSet(ctx context.Context, namespace, name string, options *StatefulSetOptions) (*appsv1.StatefulSet, error) {
+	log.Printf("Creating statefulset: namespace: %s, name: %s\n", namespace, name)
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid statefulset %s/%s: %w", namespace, name, err)
+	}
+	statefulSet, err := receiver.clientset.AppsV1().StatefulSets(namespace).Create(ctx, NewStatefulSet(namespace, name, options), metav1.CreateOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "create statefulset %s/%s", namespace, name)
+	}
+
+	return statefulSet, nil
+}
+
+func (receiver *StatefulSetController) GetStatefulSet(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+	statefulSet, err := receiver.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errs.Wrapf(err, "get statefulset %s/%s", namespace, name)
+	}
+
+	return statefulSet, nil
+}
+
+func (receiver *StatefulSetController) ListStatefulSets(ctx context.Context, namespace string) (*appsv1.StatefulSetList, error) {
+	list, err := paging.List(ctx, receiver.clientset.AppsV1().StatefulSets(namespace).List, metav1.ListOptions{}, receiver.pageSize)
+	if err != nil {
+		return nil, errs.Wrapf(err, "list statefulsets in %s", namespace)
+	}
+
+	return list, nil
+}
+
+// UpdateStatefulSet edits a statefulset with mutate. Apart from the replicas, the pod template and the update
+// strategy, most of its spec is immutable, the volume claim templates included.
+func (receiver *StatefulSetController) UpdateStatefulSet(ctx context.Context, namespace, name string, mutate MutateFunc[*appsv1.StatefulSet]) (*appsv1.StatefulSet, error) {
+	log.Printf("Updating statefulset: namespace: %s, name: %s\n", namespace, name)
+	statefulSet, err := updateNamed(ctx, receiver.backoff, receiver.clientset.AppsV1().StatefulSets(namespace), name, mutate)
+	if err != nil {
+		return nil, errs.Wrapf(err, "update statefulset %s/%s", namespace, name)
+	}
+
+	return statefulSet, nil
+}
+
+// DeleteStatefulSet deletes the statefulset and its pods. The claims created from the
+// volume claim templates are kept, unless the persistentVolumeClaimRetentionPolicy says otherwise.
+func (receiver *StatefulSetController) DeleteStatefulSet(ctx context.Context, namespace, name string) error {
+	log.Printf("Deleting statefulset: namespace: %s, name: %s\n", namespace, name)
+	deletePolicy := metav1.DeletePropagationForeground
+	err := receiver.clientset.AppsV1().StatefulSets(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &deletePolicy})
+	if err != nil {
+		return errs.Wrapf(err, "delete statefulset %s/%s", namespace, name)
+	}
+
+	return nil
+}
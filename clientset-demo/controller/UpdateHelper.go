@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// MutateFunc changes the latest version of an object in place. Returning an error aborts the update.
+type MutateFunc[T runtime.Object] func(object T) error
+
+// objectClient is the part of a typed client, e.g. AppsV1().Deployments(namespace), that updateNamed needs.
+type objectClient[T runtime.Object] interface {
+	Get(ctx context.Context, name string, options metav1.GetOptions) (T, error)
+	Update(ctx context.Context, object T, options metav1.UpdateOptions) (T, error)
+}
+
+// updateNamed is updateWithRetry for the object called name, read and written through client. It backs the
+// UpdateXxx methods of the controllers: conflicts are retried and an unchanged object is not written.
+func updateNamed[T runtime.Object](ctx context.Context, backoff wait.Backoff, client objectClient[T], name string, mutate MutateFunc[T]) (T, error) {
+	return updateWithRetry(ctx, backoff,
+		func(ctx context.Context) (T, error) {
+			return client.Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, object T) (T, error) {
+			return client.Update(ctx, object, metav1.UpdateOptions{})
+		},
+		mutate)
+}
+
+// updateWithRetry implements the "Get, modify, Update, retry on conflict" pattern shared by all controllers:
+//
+//  1. get the latest version of the object;
+//  2. let mutate change a copy of it;
+//  3. skip the write when nothing changed, otherwise Update and start over on a conflict.
+//
+// It returns the stored object, i.e. the result of Update or the unchanged object.
+// More Info:
+// https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#concurrency-control-and-consistency
+func updateWithRetry[T runtime.Object](ctx context.Context, backoff wait.Backoff,
+	get func(ctx context.Context) (T, error),
+	update func(ctx context.Context, object T) (T, error),
+	mutate MutateFunc[T]) (T, error) {
+	var stored T
+	err := retry.RetryOnConflict(backoff, func() error {
+		current, err := get(ctx)
+		if err != nil {
+			return err
+		}
+		modified := current.DeepCopyObject().(T)
+		if err := mutate(modified); err != nil {
+			return err
+		}
+		if apiequality.Semantic.DeepEqual(current, modified) {
+			stored = current
+			return nil
+		}
+
+		stored, err = update(ctx, modified)
+		return err
+	})
+
+	return stored, err
+}
+
+// createOrUpdate creates the object when get reports it missing, otherwise it brings the stored object in line
+// through mutate with updateWithRetry. created tells which of the two happened.
+func createOrUpdate[T runtime.Object](ctx context.Context, backoff wait.Backoff,
+	get func(ctx context.Context) (T, error),
+	create func(ctx context.Context) (T, error),
+	update func(ctx context.Context, object T) (T, error),
+	mutate MutateFunc[T]) (stored T, created bool, err error) {
+	if _, err = get(ctx); apierrors.IsNotFound(err) {
+		stored, err = create(ctx)
+		if !apierrors.IsAlreadyExists(err) {
+			return stored, err == nil, err
+		}
+		// Created concurrently, fall through to the update.
+	} else if err != nil {
+		return stored, false, err
+	}
+
+	stored, err = updateWithRetry(ctx, backoff, get, update, mutate)
+	return stored, false, err
+}
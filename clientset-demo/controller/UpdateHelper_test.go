@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestUpdateWithRetry(t *testing.T) {
+	configMaps := schema.GroupResource{Resource: "configmaps"}
+	tests := []struct {
+		name        string
+		updateErrs  []error // returned by the successive updates, nil once exhausted.
+		unchanged   bool
+		wantGets    int
+		wantUpdates int
+		wantErr     func(error) bool
+	}{
+		{name: "first update succeeds", wantGets: 1, wantUpdates: 1},
+		{
+			name:        "conflicts are retried",
+			updateErrs:  []error{apierrors.NewConflict(configMaps, "demo", errors.New("modified")), apierrors.NewConflict(configMaps, "demo", errors.New("modified"))},
+			wantGets:    3,
+			wantUpdates: 3,
+		},
+		{
+			name: "retries are bounded by the backoff",
+			updateErrs: []error{
+				apierrors.NewConflict(configMaps, "demo", errors.New("modified")),
+				apierrors.NewConflict(configMaps, "demo", errors.New("modified")),
+				apierrors.NewConflict(configMaps, "demo", errors.New("modified")),
+				apierrors.NewConflict(configMaps, "demo", errors.New("modified")),
+			},
+			wantGets:    3,
+			wantUpdates: 3,
+			wantErr:     apierrors.IsConflict,
+		},
+		{
+			name:        "other errors are not retried",
+			updateErrs:  []error{apierrors.NewForbidden(configMaps, "demo", errors.New("rbac"))},
+			wantGets:    1,
+			wantUpdates: 1,
+			wantErr:     apierrors.IsForbidden,
+		},
+		{name: "unchanged object is not written", unchanged: true, wantGets: 1, wantUpdates: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backoff := wait.Backoff{Steps: 3, Duration: time.Millisecond}
+			gets, updates := 0, 0
+			get := func(context.Context) (*apiv1.ConfigMap, error) {
+				gets++
+				return &apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "demo"}}, nil
+			}
+			update := func(_ context.Context, configMap *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+				updates++
+				if updates <= len(test.updateErrs) {
+					return nil, test.updateErrs[updates-1]
+				}
+				return configMap, nil
+			}
+			mutate := func(configMap *apiv1.ConfigMap) error {
+				if !test.unchanged {
+					configMap.Data = map[string]string{"key": "value"}
+				}
+				return nil
+			}
+
+			stored, err := updateWithRetry(context.Background(), backoff, get, update, mutate)
+			if test.wantErr != nil {
+				if !test.wantErr(err) {
+					t.Fatalf("updateWithRetry() error = %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("updateWithRetry() error = %v", err)
+			} else if !test.unchanged && stored.Data["key"] != "value" {
+				t.Errorf("updateWithRetry() returned %v, want the updated object", stored.Data)
+			}
+			if gets != test.wantGets || updates != test.wantUpdates {
+				t.Errorf("updateWithRetry() sent %d gets and %d updates, want %d and %d", gets, updates, test.wantGets, test.wantUpdates)
+			}
+		})
+	}
+}
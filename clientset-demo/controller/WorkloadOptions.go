@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// StatefulSetOptions describes a StatefulSet, its pod template comes from the embedded DeploymentOptions.
+type StatefulSetOptions struct {
+	DeploymentOptions
+	ServiceName          string                         // headless service giving the pods their stable network identity.
+	VolumeClaimTemplates []apiv1.PersistentVolumeClaim  // one claim per pod and template, kept across restarts.
+	PodManagementPolicy  appsv1.PodManagementPolicyType // defaults to OrderedReady.
+}
+
+func (o *StatefulSetOptions) Validate() error {
+	if o.ServiceName == "" {
+		return fmt.Errorf("service name is required")
+	}
+	return o.DeploymentOptions.Validate()
+}
+
+// JobOptions describes a Job, its pod template comes from the embedded DeploymentOptions without Replicas and Selector:
+// the API server generates the selector of a Job.
+type JobOptions struct {
+	DeploymentOptions
+	RestartPolicy           apiv1.RestartPolicy // Never or OnFailure, defaults to Never.
+	Completions             *int32              // successful pods needed, defaults to 1.
+	Parallelism             *int32              // pods running at once, defaults to 1.
+	BackoffLimit            *int32              // retries before the job fails, defaults to 6.
+	ActiveDeadlineSeconds   *int64              // fails the job when it runs longer.
+	TTLSecondsAfterFinished *int32              // deletes the job that long after it finished.
+}
+
+func (o *JobOptions) Validate() error {
+	switch o.RestartPolicy {
+	case "", apiv1.RestartPolicyNever, apiv1.RestartPolicyOnFailure:
+	default:
+		return fmt.Errorf("restart policy must be %s or %s, got %s", apiv1.RestartPolicyNever, apiv1.RestartPolicyOnFailure, o.RestartPolicy)
+	}
+	if len(o.Selector) > 0 {
+		return fmt.Errorf("the selector of a job is generated, set labels instead")
+	}
+	return o.validateContainers()
+}
+
+func (o *JobOptions) jobSpec(name string) batchv1.JobSpec {
+	template := o.podTemplate(name)
+	template.Spec.RestartPolicy = o.RestartPolicy
+	if template.Spec.RestartPolicy == "" {
+		template.Spec.RestartPolicy = apiv1.RestartPolicyNever
+	}
+
+	return batchv1.JobSpec{
+		Completions:             o.Completions,
+		Parallelism:             o.Parallelism,
+		BackoffLimit:            o.BackoffLimit,
+		ActiveDeadlineSeconds:   o.ActiveDeadlineSeconds,
+		TTLSecondsAfterFinished: o.TTLSecondsAfterFinished,
+		Template:                template,
+	}
+}
+
+// CronJobOptions describes a CronJob creating the Job described by Job on Schedule.
+type CronJobOptions struct {
+	Schedule                   string  // cron format, e.g. "*/5 * * * *".
+	TimeZone                   *string // e.g. "Asia/Shanghai", defaults to the time zone of kube-controller-manager.
+	ConcurrencyPolicy          batchv1.ConcurrencyPolicy
+	Suspend                    bool
+	SuccessfulJobsHistoryLimit *int32
+	FailedJobsHistoryLimit     *int32
+	Job                        JobOptions
+}
+
+func (o *CronJobOptions) Validate() error {
+	if o.Schedule == "" {
+		return fmt.Errorf("schedule is required")
+	}
+	return o.Job.Validate()
+}
+
+// validateJobName checks that name stays usable as the job-name label value of the job's pods.
+func validateJobName(name string) error {
+	if len(name) > validation.LabelValueMaxLength {
+		return fmt.Errorf("job name %q is longer than %d characters", name, validation.LabelValueMaxLength)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Kind classifies a failure so that callers can branch on it with errors.Is:
+//
+//	if errors.Is(err, errs.NotFound) { ... }
+type Kind string
+
+const (
+	Unknown       Kind = "Unknown"
+	NotFound      Kind = "NotFound"
+	AlreadyExists Kind = "AlreadyExists"
+	Conflict      Kind = "Conflict"
+	Forbidden     Kind = "Forbidden"
+	Timeout       Kind = "Timeout"
+	Unreachable   Kind = "Unreachable"
+	InvalidConfig Kind = "InvalidConfig"
+	RolloutFailed Kind = "RolloutFailed"
+	JobFailed     Kind = "JobFailed"
+)
+
+func (k Kind) Error() string {
+	return string(k)
+}
+
+// exitCodes maps every kind to a distinct process exit code, see ExitCode.
+var exitCodes = map[Kind]int{
+	Unknown:       1,
+	InvalidConfig: 2,
+	NotFound:      3,
+	AlreadyExists: 4,
+	Conflict:      5,
+	Forbidden:     6,
+	Timeout:       7,
+	Unreachable:   8,
+	RolloutFailed: 9,
+	JobFailed:     10,
+}
+
+// Error is a classified failure of the operation Op.
+type Error struct {
+	Kind Kind
+	Op   string // e.g. "create deployment nginx/nginx-demo".
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the Kind of e.
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// Wrap classifies err and annotates it with op. It returns nil if err is nil.
+func Wrap(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: Classify(err), Op: op, Err: err}
+}
+
+// Wrapf is like Wrap with a formatted op.
+func Wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return Wrap(fmt.Sprintf(format, args...), err)
+}
+
+// Classify returns the Kind of err using apimachinery's errors helpers.
+// Errors that were already classified keep their kind.
+func Classify(err error) Kind {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+	// apierrors.IsXxx only look at the outermost error, so unwrap to the status first.
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if statusErr, ok := status.(error); ok {
+			err = statusErr
+		}
+	}
+
+	switch {
+	case apierrors.IsNotFound(err):
+		return NotFound
+	case apierrors.IsAlreadyExists(err):
+		return AlreadyExists
+	case apierrors.IsConflict(err):
+		return Conflict
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return Forbidden
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case clientcmd.IsConfigurationInvalid(err), clientcmd.IsEmptyConfig(err), clientcmd.IsContextNotFound(err):
+		return InvalidConfig
+	case apierrors.IsServiceUnavailable(err), utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return Unreachable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return Timeout
+		}
+		return Unreachable
+	}
+
+	return Unknown
+}
+
+// ExitCode returns the process exit code for err: 0 for nil, otherwise one code per Kind.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return exitCodes[Classify(err)]
+}
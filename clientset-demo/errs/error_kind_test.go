@@ -0,0 +1,92 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var deployments = schema.GroupResource{Group: "apps", Resource: "deployments"}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{name: "not found", err: apierrors.NewNotFound(deployments, "nginx"), want: NotFound},
+		{name: "wrapped not found", err: fmt.Errorf("get: %w", apierrors.NewNotFound(deployments, "nginx")), want: NotFound},
+		{name: "already exists", err: apierrors.NewAlreadyExists(deployments, "nginx"), want: AlreadyExists},
+		{name: "conflict", err: apierrors.NewConflict(deployments, "nginx", errors.New("modified")), want: Conflict},
+		{name: "forbidden", err: apierrors.NewForbidden(deployments, "nginx", errors.New("rbac")), want: Forbidden},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("token expired"), want: Forbidden},
+		{name: "server timeout", err: apierrors.NewServerTimeout(deployments, "list", 1), want: Timeout},
+		{name: "deadline exceeded", err: fmt.Errorf("wait: %w", context.DeadlineExceeded), want: Timeout},
+		{name: "empty config", err: clientcmd.ErrEmptyConfig, want: InvalidConfig},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("down"), want: Unreachable},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, want: Unreachable},
+		{name: "net timeout", err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}, want: Timeout},
+		{name: "already classified", err: fmt.Errorf("rollout: %w", &Error{Kind: RolloutFailed, Op: "wait", Err: errors.New("stuck")}), want: RolloutFailed},
+		{name: "plain error", err: errors.New("boom"), want: Unknown},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Classify(test.err); got != test.want {
+				t.Errorf("Classify(%v) = %s, want %s", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if err := Wrapf(nil, "get deployment %s", "nginx"); err != nil {
+		t.Errorf("Wrapf(nil) = %v, want nil", err)
+	}
+
+	err := Wrapf(apierrors.NewNotFound(deployments, "nginx"), "get deployment %s/%s", "demo", "nginx")
+	if !errors.Is(err, NotFound) {
+		t.Errorf("errors.Is(%v, NotFound) = false", err)
+	}
+	if errors.Is(err, Conflict) {
+		t.Errorf("errors.Is(%v, Conflict) = true", err)
+	}
+	if !apierrors.IsNotFound(errors.Unwrap(err)) {
+		t.Errorf("Wrapf() lost the status error")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "nil", err: nil, want: 0},
+		{name: "unknown", err: errors.New("boom"), want: 1},
+		{name: "invalid config", err: Wrap("load config", clientcmd.ErrEmptyConfig), want: 2},
+		{name: "not found", err: apierrors.NewNotFound(deployments, "nginx"), want: 3},
+		{name: "job failed", err: &Error{Kind: JobFailed, Op: "wait job demo/pi", Err: errors.New("backoff limit")}, want: 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ExitCode(test.err); got != test.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", test.err, got, test.want)
+			}
+		})
+	}
+
+	codes := map[int]Kind{}
+	for kind, code := range exitCodes {
+		if other, ok := codes[code]; ok {
+			t.Errorf("%s and %s share exit code %d", kind, other, code)
+		}
+		codes[code] = kind
+	}
+}
@@ -3,96 +3,236 @@ package main
 import (
 	"clientset-demo/constant"
 	"clientset-demo/controller"
+	"clientset-demo/errs"
 	"clientset-demo/util"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-var (
-	deploymentController = &controller.DeploymentController{} // deployment controller.
-	serviceController    = &controller.ServiceController{}    // service controller.
-)
+// timeout bounds every single API call; 0 disables the deadline.
+var timeout = flag.Duration("timeout", 30*time.Second, "(optional) per-operation timeout for API requests, 0 means no timeout")
+
+// wait makes the demo follow the rollout after creating and updating the deployment.
+var wait = flag.Bool("wait", false, "(optional) wait for the deployment rollout to finish after create and update")
+
+// useCache serves the demo's reads from informer caches instead of the API server.
+var useCache = flag.Bool("cache", false, "(optional) serve list and get requests from an informer cache")
+
+// resync is the resync period of the informer cache, 0 disables resyncs.
+var resync = flag.Duration("resync", 0, "(optional) resync period of the informer cache, 0 means no resync")
+
+// nodePortRange is where the demo service picks its node ports from, it should match the API server's range.
+var nodePortRange = controller.DefaultNodePortRange
+
+func init() {
+	flag.Var(&nodePortRange, "node-port-range", "(optional) range free node ports are picked from")
+}
 
 // 参考: https://github.com/kubernetes/client-go/blob/master/examples/create-update-delete-deployment/main.go
 func main() {
+	// SIGINT/SIGTERM cancel ctx, which aborts in-flight requests and pending prompts.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Println("interrupted, exiting.")
+			os.Exit(130)
+		}
+		log.Println(err)
+		os.Exit(errs.ExitCode(err))
+	}
+}
+
+// withTimeout derives the context of a single operation from ctx.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if *timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, *timeout)
+}
+
+func run(ctx context.Context) error {
 	// Get clientset.
 	configController := controller.ConfigController{}
 	clientset, err := configController.GetClientset()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	if flag.NArg() > 0 {
+		return runCommand(ctx, &configController, clientset, flag.Args())
+	}
+
+	namespace := configController.Namespace(constant.NginxNamespace)
+	pageSize := configController.PageSize()
+	deploymentController := controller.NewDeploymentController(clientset, controller.WithPageSize(pageSize))                                        // deployment controller.
+	serviceController := controller.NewServiceController(clientset, controller.WithPageSize(pageSize), controller.WithNodePortRange(nodePortRange)) // service controller.
 
 	// namespace controller.
-	namespaceController := &controller.NamespaceController{}
-	namespaces := namespaceController.ListNamespaces(clientset)
-	for i, namespace := range namespaces {
-		log.Printf("Cluster namespace %d : %s\n", i, namespace)
+	namespaceController := controller.NewNamespaceController(clientset, controller.WithPageSize(pageSize))
+	if *useCache {
+		cache, err := controller.NewCache(clientset, *resync)
+		if err != nil {
+			return err
+		}
+		cache.Start(ctx) // informers stop with ctx.
+		opCtx, cancel := withTimeout(ctx)
+		err = cache.WaitForCacheSync(opCtx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		deploymentController.WithCache(cache)
+		serviceController.WithCache(cache)
+		namespaceController.WithCache(cache)
 	}
-
-	// Get/List deployment by namespace.
-	kubeSystemDeployments, err := deploymentController.ListDeployments(clientset, constant.KubeSystemNamespace)
+	opCtx, cancel := withTimeout(ctx)
+	namespaces, err := namespaceController.ListNamespaces(opCtx)
+	cancel()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	for i, ns := range namespaces {
+		log.Printf("Cluster namespace %d : %s\n", i, ns)
 	}
-	for _, deployment := range kubeSystemDeployments.Items {
+
+	// Get/List deployment by namespace, a page at a time.
+	log.Printf("Listing deployments in namespace %q:\n", constant.KubeSystemNamespace)
+	opCtx, cancel = withTimeout(ctx)
+	for deployment, err := range deploymentController.Deployments(opCtx, constant.KubeSystemNamespace) {
+		if err != nil {
+			cancel()
+			return err
+		}
 		log.Printf("namespace = %s, name = %s(%d replicas)\n", deployment.Namespace, deployment.Name, *deployment.Spec.Replicas)
 	}
+	cancel()
 
 	// Create deployment
-	util.Prompt()
-	deployment, err := deploymentController.CreateDeployment(clientset, constant.NginxNamespace, "nginx-demo")
+	if err := util.Prompt(ctx); err != nil {
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	_, err = namespaceController.EnsureNamespace(opCtx, namespace, nil, nil)
+	cancel()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	deployment, err := deploymentController.CreateDeployment(opCtx, namespace, "nginx-demo", controller.NginxDeploymentOptions())
+	cancel()
+	if err != nil {
+		return err
 	}
 	log.Printf("created deployment %q.\n", deployment.GetObjectMeta().GetName())
+	if *wait {
+		// The progress deadline of the deployment bounds the wait, not -timeout.
+		if err := deploymentController.WaitForRollout(ctx, namespace, "nginx-demo"); err != nil {
+			return err
+		}
+	}
 
 	// Create service
-	util.Prompt()
-	service, err := serviceController.CreateService(clientset, constant.NginxNamespace, "nginx", 30007)
+	if err := util.Prompt(ctx); err != nil {
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	inUse, err := serviceController.NodePortsInUse(opCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	for _, port := range controller.SortedNodePorts(inUse) {
+		log.Printf("node port %d is used by %s\n", port, inUse[port])
+	}
+	opCtx, cancel = withTimeout(ctx)
+	service, err := serviceController.CreateService(opCtx, namespace, "nginx", controller.NginxServiceOptions(0)) // 0: pick a free node port.
+	cancel()
 	if err != nil {
-		panic(err)
+		return err
 	}
 	log.Printf("created service namespace: %s, name: %s\n", service.GetObjectMeta().GetNamespace(), service.GetObjectMeta().GetName())
 
 	// Update service
-	util.Prompt()
-	updateService, err := serviceController.UpdateService(clientset, constant.NginxNamespace, "nginx", 30008)
+	if err := util.Prompt(ctx); err != nil {
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	newNodePort, err := serviceController.FreeNodePort(opCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	updateService, err := serviceController.UpdateServiceNodePort(opCtx, namespace, "nginx", "http", newNodePort)
+	cancel()
 	if err != nil {
-		panic(err)
+		return err
 	}
 	log.Printf("updated service namespace: %s, name: %s, nodePort: %d\n", updateService.Namespace, updateService.Name, updateService.Spec.Ports[0].NodePort)
 
 	// Delete service
-	util.Prompt()
-	ok, err := serviceController.DeleteService(clientset, constant.NginxNamespace, "nginx")
+	if err := util.Prompt(ctx); err != nil {
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	ok, err := serviceController.DeleteService(opCtx, namespace, "nginx")
+	cancel()
 	if !ok || err != nil {
-		panic(err)
+		return err
 	}
-	log.Printf("deleted service namespace: %s, name: %s\n", constant.NginxNamespace, "nginx")
+	log.Printf("deleted service namespace: %s, name: %s\n", namespace, "nginx")
 
 	// Update Deployment
-	util.Prompt()
-	err = deploymentController.UpdateDeployments(clientset, constant.NginxNamespace, "nginx-demo")
+	if err := util.Prompt(ctx); err != nil {
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	_, err = deploymentController.UpdateDeployment(opCtx, namespace, "nginx-demo", func(deployment *appsv1.Deployment) error {
+		deployment.Spec.Replicas = util.Int32Ptr(1)                                 // reduce replica count
+		deployment.Spec.Template.Spec.Containers[0].Image = constant.NginxNextImage // change nginx version
+		return nil
+	})
+	cancel()
 	if err != nil {
-		panic(fmt.Errorf("update failed: %v", err))
+		return fmt.Errorf("update failed: %w", err)
+	}
+	if *wait {
+		if err := deploymentController.WaitForRollout(ctx, namespace, "nginx-demo"); err != nil {
+			return err
+		}
 	}
 
 	// List deployments
-	util.Prompt()
-	deployments, err := deploymentController.ListDeployments(clientset, constant.NginxNamespace)
+	if err := util.Prompt(ctx); err != nil {
+		return err
+	}
+	opCtx, cancel = withTimeout(ctx)
+	deployments, err := deploymentController.ListDeployments(opCtx, namespace)
+	cancel()
 	if err != nil {
-		panic(err)
+		return err
 	}
 	for _, item := range deployments.Items {
 		log.Printf(" * namespace = %s, name = %s, replicas = %d\n", item.Namespace, item.Name, *item.Spec.Replicas)
 	}
 
 	// Delete deployments
-	util.Prompt()
-	err = deploymentController.DeleteDeployments(clientset, constant.NginxNamespace, "nginx-demo")
-	if err != nil {
-		panic(err)
+	if err := util.Prompt(ctx); err != nil {
+		return err
 	}
+	opCtx, cancel = withTimeout(ctx)
+	defer cancel()
+
+	return deploymentController.DeleteDeployments(opCtx, namespace, "nginx-demo")
 }
 
 // Cluster namespace 0 : default
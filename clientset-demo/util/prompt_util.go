@@ -2,18 +2,45 @@ package util
 
 import (
 	"bufio"
+	"context"
 	"log"
 	"os"
+	"sync"
 )
 
-func Prompt() {
-	log.Printf("-> Press Enter to continue.")
+var (
+	startReader sync.Once
+	// enters receives nil for every line read from stdin, then the read error if any,
+	// and is closed once stdin is exhausted.
+	enters = make(chan error)
+)
+
+// readStdin is the only reader of stdin, so a Prompt abandoned on ctx leaves no reader behind.
+func readStdin() {
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
-		break
+		enters <- nil
 	}
 	if err := scanner.Err(); err != nil {
-		panic(err)
+		enters <- err
+	}
+	close(enters)
+}
+
+// Prompt blocks until Enter is pressed or ctx is done, whichever comes first.
+func Prompt(ctx context.Context) error {
+	log.Printf("-> Press Enter to continue.")
+	startReader.Do(func() { go readStdin() })
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-enters:
+		if err != nil {
+			return err
+		}
 	}
 	log.Println()
+
+	return nil
 }
@@ -0,0 +1,78 @@
+package util
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// terminalSizePollInterval is how often MonitorSize checks the size of the terminal.
+const terminalSizePollInterval = 250 * time.Millisecond
+
+// Terminal is the local end of a remote TTY, like kubectl's term.TTY{Raw: true}.
+type Terminal struct {
+	In  *os.File // put in raw mode, so that keys go to the remote terminal as typed.
+	Out *os.File // its size is reported to the remote terminal.
+}
+
+// IsTerminal reports whether In is a terminal, a remote TTY is useless otherwise.
+func (t Terminal) IsTerminal() bool {
+	return term.IsTerminal(int(t.In.Fd()))
+}
+
+// Safe runs fn with In in raw mode: no local echo, no line buffering, Ctrl-C sent to the remote side.
+// The terminal is restored afterwards, also when fn panics.
+func (t Terminal) Safe(fn func() error) error {
+	state, err := term.MakeRaw(int(t.In.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(t.In.Fd()), state)
+
+	return fn()
+}
+
+// MonitorSize reports the size of Out now and whenever it changes, until ctx is done.
+func (t Terminal) MonitorSize(ctx context.Context) remotecommand.TerminalSizeQueue {
+	sizes := make(terminalSizeQueue, 1)
+	go func() {
+		defer close(sizes)
+		var last remotecommand.TerminalSize
+		ticker := time.NewTicker(terminalSizePollInterval)
+		defer ticker.Stop()
+		for {
+			if width, height, err := term.GetSize(int(t.Out.Fd())); err == nil {
+				size := remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+				if size != last {
+					select {
+					case sizes <- size:
+						last = size
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return sizes
+}
+
+// terminalSizeQueue hands the sizes of MonitorSize to the executor, it is closed once monitoring stops.
+type terminalSizeQueue chan remotecommand.TerminalSize
+
+func (q terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	size, ok := <-q
+	if !ok {
+		return nil
+	}
+	return &size
+}
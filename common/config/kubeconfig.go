@@ -0,0 +1,92 @@
+package config
+
+import (
+	"flag"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Options are the kubeconfig loading flags shared by every demo program.
+//
+// Loading follows kubectl's rules:
+//   - --kubeconfig, if set, is the only file loaded;
+//   - otherwise every file listed in $KUBECONFIG is merged, falling back to ~/.kube/config;
+//   - --context/--cluster/--user/--namespace override the merged result;
+//   - when nothing is configured and we run inside a pod, the in-cluster config is used.
+type Options struct {
+	Kubeconfig string
+	Context    string
+	Cluster    string
+	User       string
+	Namespace  string
+}
+
+// AddFlags registers the options on fs, usually flag.CommandLine.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Kubeconfig, "kubeconfig", "", "(optional) absolute path to the kubeconfig file, defaults to $KUBECONFIG or ~/.kube/config")
+	fs.StringVar(&o.Context, "context", "", "(optional) name of the kubeconfig context to use")
+	fs.StringVar(&o.Cluster, "cluster", "", "(optional) name of the kubeconfig cluster to use")
+	fs.StringVar(&o.User, "user", "", "(optional) name of the kubeconfig user to use")
+	fs.StringVar(&o.Namespace, "namespace", "", "(optional) namespace to use instead of the one of the current context")
+}
+
+// ClientConfig returns the lazily loaded, merged kubeconfig described by o.
+func (o *Options) ClientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules() // $KUBECONFIG, then ~/.kube/config.
+	loadingRules.ExplicitPath = o.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: o.Context,
+		Context: clientcmdapi.Context{
+			Cluster:   o.Cluster,
+			AuthInfo:  o.User,
+			Namespace: o.Namespace,
+		},
+	}
+
+	// The deferred loader also falls back to rest.InClusterConfig() when no kubeconfig is found.
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+}
+
+// RESTConfig resolves o into a *rest.Config.
+func (o *Options) RESTConfig() (*rest.Config, error) {
+	return o.ClientConfig().ClientConfig()
+}
+
+// ResolvedNamespace returns --namespace, the namespace of the selected context,
+// the pod's namespace when running in-cluster, or "default".
+func (o *Options) ResolvedNamespace() (string, error) {
+	namespace, _, err := o.ClientConfig().Namespace()
+	return namespace, err
+}
+
+// ExplicitNamespace returns the namespace the user chose: --namespace, the namespace set on the selected
+// context, or the pod's namespace when running in-cluster. ok is false when none of them applies and
+// ResolvedNamespace would merely fall back to "default", leaving the caller its own default.
+func (o *Options) ExplicitNamespace() (namespace string, ok bool, err error) {
+	if o.Namespace != "" {
+		return o.Namespace, true, nil
+	}
+	clientConfig := o.ClientConfig()
+	raw, err := clientConfig.RawConfig()
+	if err != nil {
+		return "", false, err
+	}
+	currentContext := raw.CurrentContext
+	if o.Context != "" {
+		currentContext = o.Context
+	}
+	if context := raw.Contexts[currentContext]; context != nil && context.Namespace != "" {
+		return context.Namespace, true, nil
+	}
+	// Like the deferred loader, use the pod's namespace in-cluster unless a kubeconfig was given explicitly.
+	if o.Kubeconfig == "" {
+		if _, err := rest.InClusterConfig(); err == nil {
+			namespace, _, err := clientConfig.Namespace()
+			return namespace, err == nil, err
+		}
+	}
+
+	return "", false, nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const kubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: demo
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: demo
+contexts:
+- name: with-namespace
+  context: {cluster: demo, user: demo, namespace: team}
+- name: without-namespace
+  context: {cluster: demo, user: demo}
+current-context: without-namespace
+`
+
+func TestExplicitNamespace(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "") // never resolve the in-cluster namespace.
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		options   Options
+		want      string
+		wantFound bool
+	}{
+		{name: "flag", options: Options{Kubeconfig: path, Namespace: "flag"}, want: "flag", wantFound: true},
+		{name: "context namespace", options: Options{Kubeconfig: path, Context: "with-namespace"}, want: "team", wantFound: true},
+		{name: "context without namespace", options: Options{Kubeconfig: path}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, found, err := test.options.ExplicitNamespace()
+			if err != nil {
+				t.Fatalf("ExplicitNamespace() error = %v", err)
+			}
+			if got != test.want || found != test.wantFound {
+				t.Errorf("ExplicitNamespace() = %q, %t, want %q, %t", got, found, test.want, test.wantFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package factory
+
+import (
+	"common/config"
+	"common/paging"
+	"flag"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
+)
+
+// Options are the kubeconfig flags plus the client tuning applied to every client the Factory hands out.
+type Options struct {
+	config.Options
+
+	QPS               float64
+	Burst             int
+	UserAgent         string
+	Impersonate       string
+	ImpersonateGroups []string
+	// PageSize is the number of objects fetched per list request, the demos page through longer lists.
+	PageSize int64
+}
+
+// AddFlags registers the options on fs, usually flag.CommandLine.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	o.Options.AddFlags(fs)
+	fs.Float64Var(&o.QPS, "qps", 50, "(optional) maximum queries per second to the API server")
+	fs.IntVar(&o.Burst, "burst", 100, "(optional) maximum burst of queries to the API server")
+	fs.StringVar(&o.UserAgent, "user-agent", "", "(optional) User-Agent header, defaults to client-go's")
+	fs.StringVar(&o.Impersonate, "as", "", "(optional) username to impersonate for the operations")
+	fs.Func("as-group", "(optional) group to impersonate for the operations, can be repeated or comma separated", func(value string) error {
+		o.ImpersonateGroups = append(o.ImpersonateGroups, strings.Split(value, ",")...)
+		return nil
+	})
+	fs.Int64Var(&o.PageSize, "page-size", paging.DefaultPageSize, "(optional) number of objects fetched per list request")
+}
+
+// Factory hands out the different kinds of clients built from one resolved rest.Config.
+// Clients are created on first use and shared afterwards.
+type Factory struct {
+	restConfig *rest.Config
+
+	mu              sync.Mutex
+	clientset       kubernetes.Interface
+	dynamicClient   dynamic.Interface
+	discoveryClient discovery.CachedDiscoveryInterface
+	restMapper      meta.ResettableRESTMapper
+	scaleClient     scale.ScalesGetter
+}
+
+// New resolves the kubeconfig described by o and applies QPS/Burst, user-agent and impersonation to it.
+func New(o *Options) (*Factory, error) {
+	restConfig, err := o.RESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	restConfig.QPS = float32(o.QPS)
+	restConfig.Burst = o.Burst
+	if o.UserAgent != "" {
+		restConfig.UserAgent = o.UserAgent
+	}
+	if o.Impersonate != "" || len(o.ImpersonateGroups) > 0 {
+		restConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: o.Impersonate,
+			Groups:   o.ImpersonateGroups,
+		}
+	}
+
+	return NewForConfig(restConfig), nil
+}
+
+// NewForConfig wraps an already resolved rest.Config.
+func NewForConfig(restConfig *rest.Config) *Factory {
+	return &Factory{restConfig: restConfig}
+}
+
+// RESTConfig returns a copy of the resolved config, safe to modify.
+func (f *Factory) RESTConfig() *rest.Config {
+	return rest.CopyConfig(f.restConfig)
+}
+
+// Clientset returns the typed clientset.
+func (f *Factory) Clientset() (kubernetes.Interface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.clientset == nil {
+		clientset, err := kubernetes.NewForConfig(f.restConfig)
+		if err != nil {
+			return nil, err
+		}
+		f.clientset = clientset
+	}
+
+	return f.clientset, nil
+}
+
+// RESTClient returns a RESTClient for the given group version, e.g. corev1.SchemeGroupVersion.
+func (f *Factory) RESTClient(gv schema.GroupVersion) (*rest.RESTClient, error) {
+	restConfig := f.RESTConfig()
+	// core group: /api/v1, others: /apis/{group}/{version}
+	restConfig.APIPath = "/apis"
+	if gv.Group == "" {
+		restConfig.APIPath = "/api"
+	}
+	restConfig.GroupVersion = &gv
+	restConfig.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+
+	return rest.RESTClientFor(restConfig)
+}
+
+// DynamicClient returns the dynamic client.
+func (f *Factory) DynamicClient() (dynamic.Interface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.dynamicClient == nil {
+		dynamicClient, err := dynamic.NewForConfig(f.restConfig)
+		if err != nil {
+			return nil, err
+		}
+		f.dynamicClient = dynamicClient
+	}
+
+	return f.dynamicClient, nil
+}
+
+// DiscoveryClient returns a discovery client caching its results in memory.
+func (f *Factory) DiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.discoveryClientLocked()
+}
+
+func (f *Factory) discoveryClientLocked() (discovery.CachedDiscoveryInterface, error) {
+	if f.discoveryClient == nil {
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(f.restConfig)
+		if err != nil {
+			return nil, err
+		}
+		f.discoveryClient = memory.NewMemCacheClient(discoveryClient)
+	}
+
+	return f.discoveryClient, nil
+}
+
+// RESTMapper returns a mapper between kinds and resources backed by the discovery client.
+// Call Reset on it after installing new CRDs.
+func (f *Factory) RESTMapper() (meta.ResettableRESTMapper, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.restMapperLocked()
+}
+
+func (f *Factory) restMapperLocked() (meta.ResettableRESTMapper, error) {
+	if f.restMapper == nil {
+		discoveryClient, err := f.discoveryClientLocked()
+		if err != nil {
+			return nil, err
+		}
+		f.restMapper = restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient)
+	}
+
+	return f.restMapper, nil
+}
+
+// ScaleClient returns a client of the /scale subresource of any resource supporting it, CRDs included.
+// Resources are mapped to their kind and scale version through discovery.
+func (f *Factory) ScaleClient() (scale.ScalesGetter, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.scaleClient == nil {
+		discoveryClient, err := f.discoveryClientLocked()
+		if err != nil {
+			return nil, err
+		}
+		restMapper, err := f.restMapperLocked()
+		if err != nil {
+			return nil, err
+		}
+		scaleClient, err := scale.NewForConfig(f.restConfig, restMapper, dynamic.LegacyAPIPathResolverFunc,
+			scale.NewDiscoveryScaleKindResolver(discoveryClient))
+		if err != nil {
+			return nil, err
+		}
+		f.scaleClient = scaleClient
+	}
+
+	return f.scaleClient, nil
+}
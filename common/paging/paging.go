@@ -0,0 +1,142 @@
+// Package paging lists resources page by page with continue tokens, so no list is silently truncated at its Limit
+// and big collections can be streamed without holding them in memory.
+package paging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultPageSize is the page size of client-go's pager, also used by kubectl.
+const DefaultPageSize int64 = 500
+
+// ListFunc lists one page, e.g. clientset.CoreV1().Pods(namespace).List wrapped to return a runtime.Object.
+type ListFunc func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error)
+
+// errStop ends the iteration when the caller breaks out of the loop.
+var errStop = errors.New("iteration stopped")
+
+// List returns every object in one list of type L, the type returned by list, fetched pageSize objects
+// at a time. The items of the later pages are appended to the first page, whose continue token is cleared:
+//
+//	deployments, err := paging.List(ctx, clientset.AppsV1().Deployments(namespace).List, metav1.ListOptions{}, pageSize)
+//
+// When the continue token expires meanwhile, it falls back to a full list like client-go's pager.
+func List[L runtime.Object](ctx context.Context, list func(context.Context, metav1.ListOptions) (L, error), options metav1.ListOptions, pageSize int64) (L, error) {
+	var result L
+	var items []runtime.Object
+	first := true
+	listPage := func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return list(ctx, options)
+	}
+	for page, err := range Pages(ctx, listPage, options, pageSize) {
+		if err != nil {
+			if !first && apierrors.IsResourceExpired(err) {
+				options.Limit = 0
+				return list(ctx, options)
+			}
+			return result, err
+		}
+		pageItems, err := meta.ExtractList(page)
+		if err != nil {
+			return result, err
+		}
+		if first {
+			result = page.(L) // page is what list returned.
+			first = false
+		}
+		items = append(items, pageItems...)
+	}
+	if first {
+		return result, errors.New("no page listed")
+	}
+
+	if err := meta.SetList(result, items); err != nil {
+		return result, err
+	}
+	listMeta, err := meta.ListAccessor(result)
+	if err != nil {
+		return result, err
+	}
+	listMeta.SetContinue("")
+	listMeta.SetRemainingItemCount(nil)
+	return result, nil
+}
+
+// Pages yields the pages of the list one by one, each a list of at most pageSize objects.
+// All pages belong to the snapshot at the resourceVersion of the first one; an expired continue token
+// (the iteration took longer than the API server keeps snapshots, 5 minutes by default) ends it with an error.
+func Pages(ctx context.Context, list ListFunc, options metav1.ListOptions, pageSize int64) iter.Seq2[runtime.Object, error] {
+	return func(yield func(runtime.Object, error) bool) {
+		options.Limit = pageSize
+		for {
+			page, err := list(ctx, options)
+			if err != nil {
+				if apierrors.IsResourceExpired(err) && options.Continue != "" {
+					err = fmt.Errorf("continue token expired, the list took too long: %w", err)
+				}
+				yield(nil, err)
+				return
+			}
+			if !yield(page, nil) {
+				return
+			}
+			listMeta, err := meta.ListAccessor(page)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if listMeta.GetContinue() == "" {
+				return
+			}
+			options.Continue = listMeta.GetContinue()
+			options.ResourceVersion = "" // the continue token carries it.
+			options.ResourceVersionMatch = ""
+		}
+	}
+}
+
+// Items yields the objects of the list one by one, as pointers of type T into the pages, e.g.
+// *appsv1.Deployment for a DeploymentList or *unstructured.Unstructured for an UnstructuredList.
+// Only the current page is kept in memory. The iteration stops at the first error:
+//
+//	for deployment, err := range paging.Items[*appsv1.Deployment](ctx, list, metav1.ListOptions{}, paging.DefaultPageSize) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func Items[T runtime.Object](ctx context.Context, list ListFunc, options metav1.ListOptions, pageSize int64) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		for page, err := range Pages(ctx, list, options, pageSize) {
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			err = meta.EachListItem(page, func(object runtime.Object) error {
+				item, ok := object.(T)
+				if !ok {
+					return fmt.Errorf("list item is a %T, not a %T", object, zero)
+				}
+				if !yield(item, nil) {
+					return errStop
+				}
+				return nil
+			})
+			if errors.Is(err, errStop) {
+				return
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package paging
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// pagedClientset serves pods page by page, the fake tracker ignores Limit and Continue.
+// The continue token is the index of the next pod. With expire set, every continued request fails
+// with 410 Expired, like a snapshot compacted away. requests counts the list requests.
+func pagedClientset(count int, expire bool, requests *int) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*requests++
+		options := action.(k8stesting.ListActionImpl).GetListOptions()
+		start := 0
+		if options.Continue != "" {
+			if expire {
+				return true, nil, apierrors.NewResourceExpired("continue token too old")
+			}
+			start, _ = strconv.Atoi(options.Continue)
+		}
+		end := count
+		if options.Limit > 0 && start+int(options.Limit) < count {
+			end = start + int(options.Limit)
+		}
+		list := &corev1.PodList{ListMeta: metav1.ListMeta{ResourceVersion: "7"}}
+		for i := start; i < end; i++ {
+			list.Items = append(list.Items, corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: fmt.Sprintf("pod-%d", i)}})
+		}
+		if end < count {
+			list.Continue = strconv.Itoa(end)
+		}
+		return true, list, nil
+	})
+	return clientset
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		name         string
+		count        int
+		pageSize     int64
+		expire       bool
+		wantRequests int
+	}{
+		{name: "empty", count: 0, pageSize: 1, wantRequests: 1},
+		{name: "single page", count: 3, pageSize: 5, wantRequests: 1},
+		{name: "one object per page", count: 3, pageSize: 1, wantRequests: 3},
+		{name: "last page shorter", count: 3, pageSize: 2, wantRequests: 2},
+		{name: "expired continue token falls back to a full list", count: 3, pageSize: 1, expire: true, wantRequests: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			clientset := pagedClientset(test.count, test.expire, &requests)
+
+			list, err := List(context.Background(), clientset.CoreV1().Pods("demo").List, metav1.ListOptions{}, test.pageSize)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(list.Items) != test.count {
+				t.Fatalf("List() returned %d pods, want %d", len(list.Items), test.count)
+			}
+			for i, pod := range list.Items {
+				if want := fmt.Sprintf("pod-%d", i); pod.Name != want {
+					t.Errorf("item %d is %s, want %s", i, pod.Name, want)
+				}
+			}
+			if list.Continue != "" {
+				t.Errorf("List() kept continue token %q", list.Continue)
+			}
+			if list.ResourceVersion != "7" {
+				t.Errorf("List() resourceVersion = %q, want the one of the first page", list.ResourceVersion)
+			}
+			if requests != test.wantRequests {
+				t.Errorf("List() sent %d requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestPagesExpired(t *testing.T) {
+	requests := 0
+	clientset := pagedClientset(3, true, &requests)
+	list := func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return clientset.CoreV1().Pods("demo").List(ctx, options)
+	}
+
+	pages := 0
+	var lastErr error
+	for page, err := range Pages(context.Background(), list, metav1.ListOptions{}, 1) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		if got := len(page.(*corev1.PodList).Items); got != 1 {
+			t.Errorf("page %d has %d items, want 1", pages, got)
+		}
+		pages++
+	}
+	if pages != 1 {
+		t.Errorf("Pages() yielded %d pages before expiring, want 1", pages)
+	}
+	if !apierrors.IsResourceExpired(lastErr) {
+		t.Errorf("Pages() error = %v, want an expired error", lastErr)
+	}
+}
+
+func TestItems(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		pageSize  int64
+		stopAfter int // 0 reads every item.
+		want      int
+	}{
+		{name: "all items across pages", count: 5, pageSize: 2, want: 5},
+		{name: "break stops the iteration", count: 5, pageSize: 2, stopAfter: 3, want: 3},
+		{name: "empty", count: 0, pageSize: 2, want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			clientset := pagedClientset(test.count, false, &requests)
+			list := func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+				return clientset.CoreV1().Pods("demo").List(ctx, options)
+			}
+
+			got := 0
+			for pod, err := range Items[*corev1.Pod](context.Background(), list, metav1.ListOptions{}, test.pageSize) {
+				if err != nil {
+					t.Fatalf("Items() error = %v", err)
+				}
+				if want := fmt.Sprintf("pod-%d", got); pod.Name != want {
+					t.Errorf("item %d is %s, want %s", got, pod.Name, want)
+				}
+				got++
+				if got == test.stopAfter {
+					break
+				}
+			}
+			if got != test.want {
+				t.Errorf("Items() yielded %d pods, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// Package watcher streams the events of any resource through the dynamic client, surviving disconnects.
+package watcher
+
+import (
+	"common/paging"
+	"context"
+	"errors"
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"log"
+	"time"
+)
+
+var (
+	// minRetryDelay and maxRetryDelay bound the exponential delay between two watch attempts
+	// that delivered no event.
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+	// after waits for the retry delay, replaced by the tests.
+	after = time.After
+)
+
+// Options select what is watched, the zero value watches every object of the resource in all namespaces.
+type Options struct {
+	Namespace     string
+	LabelSelector string
+	FieldSelector string
+	// ResourceVersion to start from. Empty lists the current objects first and delivers them as ADDED events,
+	// like "kubectl get -w".
+	ResourceVersion string
+	// PageSize is the number of objects fetched per request when listing, 0 means paging.DefaultPageSize.
+	PageSize int64
+	// Bookmarks asks the API server for BOOKMARK events, which only carry a newer resourceVersion
+	// and make resuming cheaper after a long quiet period.
+	Bookmarks bool
+}
+
+// Handler is called with every event in order. Returning an error stops the stream with it.
+type Handler func(event watch.Event) error
+
+// Stream watches gvr until ctx is done or handler fails, and returns nil once ctx is done.
+//
+// A closed connection is resumed from the resourceVersion of the last event, so no event is lost or repeated.
+// Reconnections back off exponentially, whether the connection failed or was closed cleanly, until a watch
+// delivers events again. When the resourceVersion is too old ("410 Gone"), the objects are listed again and
+// delivered as ADDED events: changes in between are then only seen through their outcome, and deletions in
+// between are not seen.
+func Stream(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, options Options, handler Handler) error {
+	resource := client.Resource(gvr).Namespace(options.Namespace)
+	resourceVersion := options.ResourceVersion
+	delay := minRetryDelay
+	for ctx.Err() == nil {
+		var err error
+		if resourceVersion == "" {
+			if resourceVersion, err = relist(ctx, resource, options, handler); err == nil {
+				continue // watch from the listed snapshot right away.
+			}
+		} else {
+			resourceVersion, err = watchFrom(ctx, resource, options, resourceVersion, handler, func() { delay = minRetryDelay })
+		}
+		var handlerErr *handlerError
+		switch {
+		case ctx.Err() != nil:
+			continue
+		case err == nil:
+			log.Printf("watch of %s closed, resuming in %v\n", gvr, delay)
+		case errors.As(err, &handlerErr):
+			return handlerErr.err
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			log.Printf("resourceVersion %s of %s is too old, relisting\n", resourceVersion, gvr)
+			resourceVersion = ""
+			continue
+		case !retriable(err):
+			return err
+		default:
+			log.Printf("watch of %s failed, retrying in %v: %v\n", gvr, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-after(delay):
+		}
+		delay = min(2*delay, maxRetryDelay)
+	}
+
+	return nil
+}
+
+// relist delivers the current objects as ADDED events and returns the resourceVersion of the list.
+func relist(ctx context.Context, resource dynamic.ResourceInterface, options Options, handler Handler) (string, error) {
+	pageSize := options.PageSize
+	if pageSize == 0 {
+		pageSize = paging.DefaultPageSize
+	}
+	list := func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+		return resource.List(ctx, options)
+	}
+	var resourceVersion string
+	for page, err := range paging.Pages(ctx, list, metav1.ListOptions{LabelSelector: options.LabelSelector, FieldSelector: options.FieldSelector}, pageSize) {
+		if err != nil {
+			return "", err
+		}
+		unstructuredList := page.(*unstructured.UnstructuredList)
+		for i := range unstructuredList.Items {
+			if err := handler(watch.Event{Type: watch.Added, Object: &unstructuredList.Items[i]}); err != nil {
+				return "", &handlerError{err}
+			}
+		}
+		resourceVersion = unstructuredList.GetResourceVersion() // every page is at the resourceVersion of the snapshot.
+	}
+
+	return resourceVersion, nil
+}
+
+// watchFrom delivers the events following resourceVersion until the connection closes.
+// It returns the resourceVersion to resume from, and calls progress whenever an event arrives.
+func watchFrom(ctx context.Context, resource dynamic.ResourceInterface, options Options, resourceVersion string, handler Handler, progress func()) (string, error) {
+	w, err := resource.Watch(ctx, metav1.ListOptions{
+		LabelSelector:       options.LabelSelector,
+		FieldSelector:       options.FieldSelector,
+		ResourceVersion:     resourceVersion,
+		AllowWatchBookmarks: options.Bookmarks,
+	})
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion, nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return resourceVersion, nil // closed by the server or a proxy, resume.
+			}
+			if event.Type == watch.Error {
+				return resourceVersion, apierrors.FromObject(event.Object)
+			}
+			progress()
+			if version, err := objectResourceVersion(event.Object); err == nil && version != "" {
+				resourceVersion = version
+			}
+			if err := handler(event); err != nil {
+				return resourceVersion, &handlerError{err}
+			}
+		}
+	}
+}
+
+func objectResourceVersion(object runtime.Object) (string, error) {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return "", err
+	}
+	return accessor.GetResourceVersion(), nil
+}
+
+// handlerError marks errors of the Handler, which end the stream as is instead of being retried.
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return fmt.Sprintf("watch handler: %v", e.err)
+}
+
+func (e *handlerError) Unwrap() error {
+	return e.err
+}
+
+// retriable tells the errors worth reconnecting after: dropped connections and overloaded or restarting servers.
+func retriable(err error) bool {
+	return utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err) || utilnet.IsConnectionRefused(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err)
+}
@@ -0,0 +1,159 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var pods = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// attempt scripts one watch request: its error, or the events delivered before the connection closes.
+type attempt struct {
+	err    error
+	events []watch.Event
+}
+
+func pod(name, resourceVersion string) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion("v1")
+	object.SetKind("Pod")
+	object.SetNamespace("demo")
+	object.SetName(name)
+	object.SetResourceVersion(resourceVersion)
+	return object
+}
+
+func added(name, resourceVersion string) watch.Event {
+	return watch.Event{Type: watch.Added, Object: pod(name, resourceVersion)}
+}
+
+func expired() watch.Event {
+	status := apierrors.NewResourceExpired("too old").Status()
+	return watch.Event{Type: watch.Error, Object: &status}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     []attempt
+		wantDelays   []time.Duration
+		wantVersions []string // resourceVersion of every watch request.
+		wantEvents   []string
+		wantErr      func(error) bool
+	}{
+		{
+			name:         "clean closes back off",
+			attempts:     []attempt{{}, {}, {}},
+			wantDelays:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+			wantVersions: []string{"1", "1", "1", "1"},
+		},
+		{
+			name:         "events reset the backoff",
+			attempts:     []attempt{{}, {events: []watch.Event{added("a", "2"), added("b", "3")}}, {}},
+			wantDelays:   []time.Duration{time.Second, time.Second, 2 * time.Second},
+			wantVersions: []string{"1", "1", "3", "3"},
+			wantEvents:   []string{"a", "b"},
+		},
+		{
+			name:         "retriable errors back off",
+			attempts:     []attempt{{err: apierrors.NewServiceUnavailable("restarting")}, {err: apierrors.NewTooManyRequests("slow down", 1)}},
+			wantDelays:   []time.Duration{time.Second, 2 * time.Second},
+			wantVersions: []string{"1", "1", "1"},
+		},
+		{
+			name:         "expired version relists without delay",
+			attempts:     []attempt{{events: []watch.Event{expired()}}},
+			wantVersions: []string{"1", "5"},
+			wantEvents:   []string{"listed"},
+		},
+		{
+			name:         "other errors end the stream",
+			attempts:     []attempt{{err: apierrors.NewForbidden(pods.GroupResource(), "", errors.New("rbac"))}},
+			wantVersions: []string{"1"},
+			wantErr:      apierrors.IsForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var delays []time.Duration
+			after = func(delay time.Duration) <-chan time.Time {
+				delays = append(delays, delay)
+				return time.After(0)
+			}
+			defer func() { after = time.After }()
+
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{pods: "PodList"})
+			client.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+				list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "v1", "kind": "PodList"}}
+				list.SetResourceVersion("5")
+				list.Items = []unstructured.Unstructured{*pod("listed", "4")}
+				return true, list, nil
+			})
+			var versions []string
+			client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+				versions = append(versions, action.(k8stesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion)
+				if len(versions) > len(test.attempts) {
+					cancel() // script exhausted, end the stream.
+					return true, watch.NewFake(), nil
+				}
+				next := test.attempts[len(versions)-1]
+				if next.err != nil {
+					return true, nil, next.err
+				}
+				w := watch.NewFakeWithChanSize(len(next.events), false)
+				for _, event := range next.events {
+					w.Action(event.Type, event.Object)
+				}
+				w.Stop()
+				return true, w, nil
+			})
+
+			var events []string
+			err := Stream(ctx, client, pods, Options{Namespace: "demo", ResourceVersion: "1"}, func(event watch.Event) error {
+				events = append(events, event.Object.(metav1.Object).GetName())
+				return nil
+			})
+			if test.wantErr != nil {
+				if !test.wantErr(err) {
+					t.Fatalf("Stream() error = %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if !slices.Equal(delays, test.wantDelays) {
+				t.Errorf("Stream() waited %v, want %v", delays, test.wantDelays)
+			}
+			if !slices.Equal(versions, test.wantVersions) {
+				t.Errorf("Stream() watched from %v, want %v", versions, test.wantVersions)
+			}
+			if !slices.Equal(events, test.wantEvents) {
+				t.Errorf("Stream() delivered %v, want %v", events, test.wantEvents)
+			}
+		})
+	}
+}
+
+func TestStreamHandlerError(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{pods: "PodList"}, pod("a", "1"))
+	stop := errors.New("stop")
+
+	err := Stream(context.Background(), client, pods, Options{Namespace: "demo"}, func(watch.Event) error { return stop })
+	if err != stop {
+		t.Fatalf("Stream() error = %v, want the handler's", err)
+	}
+}
@@ -1,33 +1,25 @@
 package main
 
 import (
+	"common/factory"
 	"flag"
 	"fmt"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/discovery"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
-	"path/filepath"
 )
 
 // 需求: 从kubernetes查询所有的Group, Version, Resource信息, 在控制台打印出来.
 func main() {
-	var kubeconfig *string
-
-	// kubeconfig两种获取方式: 1. home家目录(~/.kube/config); 2. 控制台输入绝对路径获取.
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-
-	flag.Parse() // 解析控制台输入的: -kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	// kubeconfig加载规则: 1. -kubeconfig指定的文件; 2. $KUBECONFIG中的多个文件合并; 3. home家目录(~/.kube/config); 4. pod内的in-cluster配置.
+	// 可通过-context/-cluster/-user/-namespace覆盖kubeconfig中的配置, -qps/-burst/-user-agent/-as/-as-group调整客户端.
+	var options factory.Options
+	options.AddFlags(flag.CommandLine)
+	flag.Parse() // 解析控制台输入的参数
+	f, err := factory.New(&options)
 	if err != nil {
 		panic(err)
 	}
 
-	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	discoveryClient, err := f.DiscoveryClient()
 	if err != nil {
 		panic(err)
 	}
@@ -1,64 +1,84 @@
 package main
 
 import (
+	"common/factory"
+	"common/paging"
+	"common/watcher"
 	"context"
 	"flag"
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
-	"path/filepath"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 // 需求: 查询指定namespace下的所有pod, 然后在控制台打印出来, 要求用dynamicClient实现.
 // 优化: 后期可以使用自定义CRD进行优化.
 func main() {
-	var kubeconfig *string
-
-	// kubeconfig两种获取方式: 1. home家目录(~/.kube/config); 2. 控制台输入绝对路径获取.
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-
-	flag.Parse() // 解析控制台输入的: -kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	// kubeconfig加载规则: 1. -kubeconfig指定的文件; 2. $KUBECONFIG中的多个文件合并; 3. home家目录(~/.kube/config); 4. pod内的in-cluster配置.
+	// 可通过-context/-cluster/-user/-namespace覆盖kubeconfig中的配置, -qps/-burst/-user-agent/-as/-as-group调整客户端.
+	var options factory.Options
+	options.AddFlags(flag.CommandLine)
+	// watch模式: 持续打印指定资源的事件, 如 -watch pods, -watch deployments.apps.
+	watchResource := flag.String("watch", "", "(optional) resource to watch instead of listing pods, e.g. pods or deployments.apps")
+	var watchOptions watcher.Options
+	flag.StringVar(&watchOptions.LabelSelector, "selector", "", "(optional) label selector of the watched objects")
+	flag.StringVar(&watchOptions.ResourceVersion, "resource-version", "", "(optional) resourceVersion to start watching from, empty lists the current objects first")
+	flag.BoolVar(&watchOptions.Bookmarks, "bookmarks", true, "(optional) ask for BOOKMARK events while watching")
+	flag.Parse() // 解析控制台输入的参数
+	watchOptions.PageSize = options.PageSize
+	f, err := factory.New(&options)
 	if err != nil {
 		panic(err)
 	}
 
-	dynamicClient, err := dynamic.NewForConfig(config)
+	dynamicClient, err := f.DynamicClient()
 	if err != nil {
 		panic(err)
 	}
+	// 查询的namespace, 默认kube-system, 可通过-namespace覆盖
+	namespace := "kube-system"
+	if options.Namespace != "" {
+		namespace = options.Namespace
+	}
+	if *watchResource != "" {
+		// Ctrl+C结束watch.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		// watch默认所有namespace, 可通过-namespace只watch一个namespace.
+		watchNamespace := metav1.NamespaceAll
+		if options.Namespace != "" {
+			watchNamespace = options.Namespace
+		}
+		if err := runWatch(ctx, f, *watchResource, watchNamespace, watchOptions); err != nil {
+			panic(err)
+		}
+		return
+	}
 	// dynamicClient唯一关联方法所需要的入参
 	gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
-	// 返回类型: unstructured非结构化对象
-	unstructuredList, err := dynamicClient.Resource(gvr).
-		Namespace("kube-system").
-		List(context.TODO(), metav1.ListOptions{Limit: 100})
-	if err != nil {
-		panic(err)
-	}
-
-	// 实例化podList用于接收unstructured非结构化对象的转换.
-	podList := &corev1.PodList{}
-
-	// unstructuredList -> podList
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredList.UnstructuredContent(), podList)
-	if err != nil {
-		panic(err)
+	// 返回类型: unstructured非结构化对象, 每页-page-size个, 通过continue token翻页直到取完.
+	list := func(ctx context.Context, listOptions metav1.ListOptions) (runtime.Object, error) {
+		return dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, listOptions)
 	}
 
 	// 打印表头
 	fmt.Printf("namespace\t\tstatus\t\tname\n")
-	for _, item := range podList.Items {
-		fmt.Printf("%v\t\t%v\t\t%v\n", item.Namespace, item.Status.Phase, item.Name)
+	for item, err := range paging.Items[*unstructured.Unstructured](context.TODO(), list, metav1.ListOptions{}, options.PageSize) {
+		if err != nil {
+			panic(err)
+		}
+		// 实例化pod用于接收unstructured非结构化对象的转换: unstructured -> pod
+		pod := &corev1.Pod{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.UnstructuredContent(), pod); err != nil {
+			panic(err)
+		}
+		fmt.Printf("%v\t\t%v\t\t%v\n", pod.Namespace, pod.Status.Phase, pod.Name)
 	}
 }
 // namespace		status		name
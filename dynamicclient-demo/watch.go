@@ -0,0 +1,73 @@
+package main
+
+import (
+	"common/factory"
+	"common/watcher"
+	"context"
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"time"
+)
+
+// runWatch 持续打印resource的ADDED/MODIFIED/DELETED事件, 直到ctx结束.
+// resource的格式同kubectl: pods, deployments.apps 或 deployments.v1.apps.
+// 断线后从最后一个resourceVersion继续watch, resourceVersion过期(410 Gone)时重新list.
+func runWatch(ctx context.Context, f *factory.Factory, resource, namespace string, options watcher.Options) error {
+	mapper, err := f.RESTMapper()
+	if err != nil {
+		return err
+	}
+	gvr, mapping, err := resolveResource(mapper, resource)
+	if err != nil {
+		return err
+	}
+	// 集群级别的资源(如nodes, namespaces)没有namespace.
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		options.Namespace = namespace
+	}
+	dynamicClient, err := f.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	// 打印表头
+	fmt.Printf("time\t\tevent\t\tnamespace/name\t\tresourceVersion\n")
+	return watcher.Stream(ctx, dynamicClient, gvr, options, func(event watch.Event) error {
+		object, err := meta.Accessor(event.Object)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\t%s\t%s/%s\t%s\n", time.Now().Format(time.TimeOnly), event.Type,
+			object.GetNamespace(), object.GetName(), object.GetResourceVersion())
+		return nil
+	})
+}
+
+// resolveResource 通过discovery把kubectl风格的资源名解析为GVR.
+func resolveResource(mapper meta.RESTMapper, resource string) (schema.GroupVersionResource, *meta.RESTMapping, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(resource)
+	gvr := groupResource.WithVersion("")
+	if fullySpecified != nil {
+		if resolved, err := mapper.ResourceFor(*fullySpecified); err == nil {
+			gvr = resolved
+		}
+	}
+	if gvr.Version == "" {
+		resolved, err := mapper.ResourceFor(gvr)
+		if err != nil {
+			return gvr, nil, fmt.Errorf("unknown resource %q: %w", resource, err)
+		}
+		gvr = resolved
+	}
+	gvk, err := mapper.KindFor(gvr)
+	if err != nil {
+		return gvr, nil, err
+	}
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return gvr, nil, err
+	}
+	return gvr, mapping, nil
+}
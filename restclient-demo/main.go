@@ -1,66 +1,62 @@
 package main
 
 import (
+	"common/factory"
+	"common/paging"
 	"context"
 	"flag"
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
-	"path/filepath"
 )
 
 func main() {
-	var kubeconfig *string
-
-	// kubeconfig两种获取方式: 1. home家目录(~/.kube/config); 2. 控制台输入绝对路径获取.
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-
-	flag.Parse() // 解析控制台输入的: -kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	// kubeconfig加载规则: 1. -kubeconfig指定的文件; 2. $KUBECONFIG中的多个文件合并; 3. home家目录(~/.kube/config); 4. pod内的in-cluster配置.
+	// 可通过-context/-cluster/-user/-namespace覆盖kubeconfig中的配置, -qps/-burst/-user-agent/-as/-as-group调整客户端.
+	var options factory.Options
+	options.AddFlags(flag.CommandLine)
+	flag.Parse() // 解析控制台输入的参数
+	f, err := factory.New(&options)
 	if err != nil {
 		panic(err)
 	}
 
 	// https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.21/#list-pod-v1-core
 	// 参考: /api/v1/namespaces/{namespace}/pods
-	config.APIPath = "api"
-	// pod group: apiVersion: v1
-	config.GroupVersion = &corev1.SchemeGroupVersion
-	// 指定序列化工具
-	config.NegotiatedSerializer = scheme.Codecs
-
-	// 根据config获取RESTClient实例
-	restClient, err := rest.RESTClientFor(config)
+	// factory根据group设置APIPath(core group: /api), GroupVersion(pod group: apiVersion: v1)和序列化工具,
+	// 然后获取RESTClient实例
+	restClient, err := f.RESTClient(corev1.SchemeGroupVersion)
 	if err != nil {
 		panic(err)
 	}
 
-	// 保存获取pods
-	result := &corev1.PodList{}
-	// 获取指定namespace的pods
+	// 获取指定namespace的pods, 默认kube-system, 可通过-namespace覆盖
 	namespace := "kube-system"
-	// GET请求
-	err = restClient.Get().
-		Namespace(namespace). // 指定namespace: 参考: /api/v1/namespaces/{namespace}/pods
-		Resource("pods"). // 查找多个pod: 参考: /api/v1/namespaces/{namespace}/pods
-		VersionedParams(&metav1.ListOptions{Limit: 100}, scheme.ParameterCodec). // 指定大小限制和序列化工具
-		Do(context.TODO()). // 请求
-		Into(result) // 结果存入result
-	if err != nil {
-		panic(err)
+	if options.Namespace != "" {
+		namespace = options.Namespace
+	}
+	// 获取一页pods, paging通过listOptions中的limit(-page-size)和continue token翻页直到取完.
+	list := func(ctx context.Context, listOptions metav1.ListOptions) (runtime.Object, error) {
+		// 保存获取的一页pods
+		result := &corev1.PodList{}
+		// GET请求
+		err := restClient.Get().
+			Namespace(namespace).                                 // 指定namespace: 参考: /api/v1/namespaces/{namespace}/pods
+			Resource("pods").                                     // 查找多个pod: 参考: /api/v1/namespaces/{namespace}/pods
+			VersionedParams(&listOptions, scheme.ParameterCodec). // 指定分页参数和序列化工具
+			Do(ctx).                                              // 请求
+			Into(result)                                          // 结果存入result
+		return result, err
 	}
 
 	// 打印表头
 	fmt.Printf("namespace\t\tstatus\t\tname\n")
-	for _, item := range result.Items {
+	for item, err := range paging.Items[*corev1.Pod](context.TODO(), list, metav1.ListOptions{}, options.PageSize) {
+		if err != nil {
+			panic(err)
+		}
 		fmt.Printf("%v\t\t%v\t\t%v\n", item.Namespace, item.Status.Phase, item.Name)
 	}
 